@@ -2,12 +2,15 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 func saveMovie(movie *Movie) error {
@@ -17,12 +20,31 @@ func saveMovie(movie *Movie) error {
 	}
 	defer tx.Rollback()
 
+	if err := saveMovieTx(tx, movie); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveMovieTx inserts or updates the movie inside an existing transaction
+func saveMovieTx(tx *sql.Tx, movie *Movie) error {
 	var result sql.Result
+	var err error
+	if movie.Auditorium == "" {
+		movie.Auditorium = defaultAuditorium
+	}
+	if movie.Currency == "" {
+		movie.Currency = siteCurrency()
+	}
 	if movie.ID == 0 {
 		// Insert new movie
 		result, err = tx.Exec(
-			"INSERT INTO movies (title, time, duration, image, price) VALUES (?, ?, ?, ?, ?)",
-			movie.Title, movie.Time, movie.Duration, movie.Image, movie.Price,
+			`INSERT INTO movies (title, starts_at, runtime, image, price_minor, currency, auditorium,
+                genre, age_rating, synopsis, cast_members, director, language, release_date, trailer_url, poster)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			movie.Title, movie.Time.UTC(), movie.Runtime, movie.Image, movie.Price, movie.Currency, movie.Auditorium,
+			movie.Genre, movie.AgeRating, movie.Synopsis, movie.Cast, movie.Director, movie.Language, movie.ReleaseDate, movie.TrailerURL, movie.Poster,
 		)
 		if err != nil {
 			return err
@@ -36,8 +58,8 @@ func saveMovie(movie *Movie) error {
 		movie.ID = int(lastID)
 
 		// Initialize empty seat grid
-		for r := 0; r < 8; r++ {
-			for c := 0; c < 10; c++ {
+		for r := 0; r < seatGridRows; r++ {
+			for c := 0; c < seatGridCols; c++ {
 				_, err = tx.Exec(
 					"INSERT INTO seats (movie_id, row, col, is_booked) VALUES (?, ?, ?, ?)",
 					movie.ID, r, c, 0,
@@ -47,139 +69,177 @@ func saveMovie(movie *Movie) error {
 				}
 			}
 		}
-
-		// After getting the ID for a new movie
-		if movie.ID > 0 && movie.Image == "" {
-			movie.Image = GetImageURL(movie.ID)
-			// Update the image in the database
-			_, err = tx.Exec("UPDATE movies SET image = ? WHERE id = ?", movie.Image, movie.ID)
-			if err != nil {
-				log.Printf("Error updating image path: %v", err)
-			}
-		}
 	} else {
 		// Update existing movie
 		_, err = tx.Exec(
-			"UPDATE movies SET title = ?, time = ?, duration = ?, image = ?, price = ? WHERE id = ?",
-			movie.Title, movie.Time, movie.Duration, movie.Image, movie.Price, movie.ID,
+			`UPDATE movies SET title = ?, starts_at = ?, runtime = ?, image = ?, price_minor = ?, currency = ?, auditorium = ?,
+                genre = ?, age_rating = ?, synopsis = ?, cast_members = ?, director = ?, language = ?, release_date = ?, trailer_url = ?, poster = ?
+            WHERE id = ?`,
+			movie.Title, movie.Time.UTC(), movie.Runtime, movie.Image, movie.Price, movie.Currency, movie.Auditorium,
+			movie.Genre, movie.AgeRating, movie.Synopsis, movie.Cast, movie.Director, movie.Language, movie.ReleaseDate, movie.TrailerURL, movie.Poster,
+			movie.ID,
 		)
 		if err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	return indexMovie(tx, movie)
 }
 
 func deleteMovie(id int) error {
+	var poster string
+	db.QueryRow("SELECT poster FROM movies WHERE id = ?", id).Scan(&poster)
+
 	// SQLite with cascade will handle deleting associated records
 	_, err := db.Exec("DELETE FROM movies WHERE id = ?", id)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Foreign keys aren't enforced, so remove the screening's seat blocks here
+	_, err = db.Exec("DELETE FROM seat_blocks WHERE movie_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if err := unindexMovie(id); err != nil {
+		return err
+	}
+
+	removePoster(poster)
+	return nil
 }
 
 func adminMovieHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		// Parse form data
+		// Parse form data, leaving room for the poster and the other fields
+		r.Body = http.MaxBytesReader(w, r.Body, maxPosterSize+1<<20)
 		err := r.ParseMultipartForm(32 << 20) // 32MB max memory
-		if err != nil {
-			http.Error(w, "Error parsing form", http.StatusBadRequest)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			renderAdminMovies(w, r, Movie{Auditorium: defaultAuditorium, Currency: siteCurrency()}, fmt.Errorf("the poster must be smaller than %d MB", maxPosterSize>>20))
+			return
+		} else if err != nil {
+			httpError(w, r, http.StatusBadRequest, "Error parsing form")
 			return
 		}
 
 		// Extract movie data
 		idStr := r.FormValue("id")
 		title := r.FormValue("title")
-		showtime := r.FormValue("time")
-		duration := r.FormValue("duration")
-
-		price, err := strconv.ParseFloat(r.FormValue("price"), 64)
-		if err != nil {
-			price = 0
-		}
+		showtime, showtimeErr := parseShowtime(r.FormValue("time"))
+		runtime, runtimeErr := parseRuntime(r.FormValue("runtime"))
+		auditorium := strings.TrimSpace(r.FormValue("auditorium"))
 
 		var id int
 		if idStr != "" {
 			id, _ = strconv.Atoi(idStr)
 		}
 
+		// Keep the current values for the audit log
+		var before *Movie
+		if existing := getMovie(id); existing != nil {
+			copied := *existing
+			before = &copied
+		}
+
 		// Create or update movie
 		movie := &Movie{
-			ID:       id,
-			Title:    title,
-			Time:     showtime,
-			Duration: duration,
-			Price:    price,
+			ID:         id,
+			Title:      title,
+			Time:       showtime,
+			Runtime:    runtime,
+			Currency:   r.FormValue("currency"),
+			Auditorium: auditorium,
+
+			Genre:       r.FormValue("genre"),
+			AgeRating:   r.FormValue("age_rating"),
+			Synopsis:    r.FormValue("synopsis"),
+			Cast:        r.FormValue("cast"),
+			Director:    r.FormValue("director"),
+			Language:    r.FormValue("language"),
+			ReleaseDate: r.FormValue("release_date"),
+			TrailerURL:  r.FormValue("trailer_url"),
+		}
+		for _, err := range []error{showtimeErr, runtimeErr} {
+			if err != nil {
+				renderAdminMovies(w, r, *movie, err)
+				return
+			}
+		}
+		if err := normalizeMovieDetails(movie); err != nil {
+			renderAdminMovies(w, r, *movie, err)
+			return
+		}
+		price, err := parseMoney(r.FormValue("price"), movie.Currency)
+		if err != nil || price < 0 {
+			renderAdminMovies(w, r, *movie, errInvalidPrice)
+			return
 		}
+		movie.Price = price
 
-		// Handle image upload
+		// Reject showtimes that clash with another screening in the auditorium
+		if err := checkSchedule(*movie); err != nil {
+			renderAdminMovies(w, r, *movie, err)
+			return
+		}
+
+		// Handle image upload. The poster is checked and resized before
+		// anything is saved, so a bad upload leaves the movie untouched.
+		var poster *Poster
 		file, _, err := r.FormFile("image")
 		if err == nil {
 			defer file.Close()
-
-			// Save the uploaded file
-			imagePath := GetImagePath(movie.ID)
-			if movie.ID == 0 {
-				// For new movies, we'll set the image after we get the ID
-				movie.Image = ""
-			} else {
-				movie.Image = GetImageURL(movie.ID)
-
-				// Save the file
-				f, err := os.Create(imagePath)
-				if err != nil {
-					http.Error(w, "Error saving image: "+err.Error(), http.StatusInternalServerError)
-					return
-				}
-				defer f.Close()
-				io.Copy(f, file)
-			}
-		} else {
-			// No new image uploaded
-			if movie.ID > 0 {
-				// Keep existing image for updates
-				var existingImage string
-				err := db.QueryRow("SELECT image FROM movies WHERE id = ?", movie.ID).Scan(&existingImage)
-				if err == nil {
-					movie.Image = existingImage
-				} else {
-					movie.Image = GetImageURL(movie.ID)
-				}
-			} else {
-				// Use default image for new movies
-				movie.Image = "/static/images/default.jpg"
+			if poster, err = processPoster(file); err != nil {
+				renderAdminMovies(w, r, *movie, err)
+				return
 			}
+		} else if err != http.ErrMissingFile {
+			httpError(w, r, http.StatusBadRequest, "Error reading image")
+			return
+		}
+
+		// Keep the current image unless a new one was uploaded. New movies
+		// without one get a generated placeholder.
+		if before != nil {
+			movie.Image = before.Image
+			movie.Poster = before.Poster
 		}
 
 		// Save the movie
 		err = saveMovie(movie)
 		if err != nil {
-			http.Error(w, "Error saving movie: "+err.Error(), http.StatusInternalServerError)
+			serverError(w, r, fmt.Errorf("saving movie: %w", err))
 			return
 		}
 
-		// For new movies, now that we have the ID, we can save the image properly
-		if movie.ID > 0 && movie.Image == "" {
-			movie.Image = GetImageURL(movie.ID)
-			_, err = db.Exec("UPDATE movies SET image = ? WHERE id = ?", movie.Image, movie.ID)
+		// Store the renditions now that a new movie has its ID
+		if poster != nil {
+			previous := movie.Poster
+			ref, err := savePoster(r.Context(), movie.ID, poster)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("saving poster for movie %d: %w", movie.ID, err))
+				return
+			}
+			movie.Poster = ref
+			movie.Image = posterURL(ref, "card")
+			_, err = db.Exec("UPDATE movies SET image = ?, poster = ? WHERE id = ?", movie.Image, movie.Poster, movie.ID)
 			if err != nil {
 				log.Printf("Error updating image path: %v", err)
 			}
-
-			// If we had a file uploaded, save it with the proper name
-			if file != nil {
-				// Seek back to beginning of file
-				file.Seek(0, 0)
-
-				// Save with proper name
-				imagePath := GetImagePath(movie.ID)
-				f, err := os.Create(imagePath)
-				if err == nil {
-					defer f.Close()
-					io.Copy(f, file)
-				}
+			if previous != ref {
+				removePoster(previous)
 			}
 		}
 
+		user, _ := getUserFromSession(r)
+		if before != nil {
+			recordAudit(r, user, "movie.update", "movie", movie.ID, before, movie)
+		} else {
+			recordAudit(r, user, "movie.create", "movie", movie.ID, nil, movie)
+		}
+
 		// Refresh the movies slice
 		loadMovies()
 
@@ -187,10 +247,62 @@ func adminMovieHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ?edit= fills the form with an existing movie
+	form := Movie{Auditorium: defaultAuditorium, Currency: siteCurrency()}
+	if id, err := strconv.Atoi(r.URL.Query().Get("edit")); err == nil {
+		if existing := getMovie(id); existing != nil {
+			form = *existing
+		}
+	}
+	renderAdminMovies(w, r, form, nil)
+}
+
+// renderAdminMovies shows the movie list and the add/edit form, along with
+// any problem saving the form and the screenings it clashes with
+func renderAdminMovies(w http.ResponseWriter, r *http.Request, form Movie, formErr error) {
+	user, _ := getUserFromSession(r)
+
+	data := struct {
+		User           User
+		Movies         []Movie
+		Form           Movie
+		Error          string
+		Conflicts      []Slot
+		BufferMinutes  int
+		AgeRatings     []string
+		Currencies     []Currency
+		TimeZone       string
+		MaxPosterMB    int
+		MinPosterWidth int
+	}{
+		User:           user,
+		Movies:         movies,
+		Form:           form,
+		BufferMinutes:  int(cleaningBuffer() / time.Minute),
+		AgeRatings:     ageRatings,
+		Currencies:     currencies,
+		TimeZone:       cinemaLocation().String(),
+		MaxPosterMB:    maxPosterSize >> 20,
+		MinPosterWidth: minPosterWidth,
+	}
+	if formErr != nil {
+		// Validation messages are shared with the import, which shows them lower case
+		msg := formErr.Error()
+		if first, size := utf8.DecodeRuneInString(msg); size > 0 {
+			msg = string(unicode.ToUpper(first)) + msg[size:]
+		}
+		data.Error = msg
+		var conflict ScheduleConflictError
+		if errors.As(formErr, &conflict) {
+			data.Error = "This showtime overlaps other screenings in " + conflict.Auditorium
+			data.Conflicts = conflict.Conflicts
+		}
+	}
+
 	// Display the form with movie list
-	err := templates.ExecuteTemplate(w, "admin_movies", movies)
+	err := templates.Render(w, r, "admin_movies", data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
@@ -198,16 +310,25 @@ func adminDeleteMovieHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Path[len("/admin/movies/delete/"):]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid movie ID", http.StatusBadRequest)
+		httpError(w, r, http.StatusBadRequest, "Invalid movie ID")
 		return
 	}
 
+	var before *Movie
+	if existing := getMovie(id); existing != nil {
+		copied := *existing
+		before = &copied
+	}
+
 	err = deleteMovie(id)
 	if err != nil {
-		http.Error(w, "Error deleting movie: "+err.Error(), http.StatusInternalServerError)
+		serverError(w, r, fmt.Errorf("deleting movie: %w", err))
 		return
 	}
 
+	user, _ := getUserFromSession(r)
+	recordAudit(r, user, "movie.delete", "movie", id, before, nil)
+
 	// Refresh the movies slice
 	loadMovies()
 
@@ -217,7 +338,7 @@ func adminDeleteMovieHandler(w http.ResponseWriter, r *http.Request) {
 // Fix the end of loadMovies function around line 272
 func loadMovies() {
 	// Load movies from SQLite
-	rows, err := db.Query("SELECT id, title, time, duration, image, price FROM movies")
+	rows, err := db.Query("SELECT " + movieColumns + " FROM movies ORDER BY starts_at, title")
 	if err != nil {
 		log.Println("Error loading movies:", err)
 		return
@@ -227,15 +348,15 @@ func loadMovies() {
 	var loadedMovies []Movie
 	for rows.Next() {
 		var movie Movie
-		if err := rows.Scan(&movie.ID, &movie.Title, &movie.Time, &movie.Duration, &movie.Image, &movie.Price); err != nil {
+		if err := scanMovie(rows, &movie); err != nil {
 			log.Println("Error scanning movie row:", err)
 			continue
 		}
 
 		// Initialize the seats array
-		movie.Seats = make([][]bool, 8)
+		movie.Seats = make([][]bool, seatGridRows)
 		for i := range movie.Seats {
-			movie.Seats[i] = make([]bool, 10)
+			movie.Seats[i] = make([]bool, seatGridCols)
 		}
 
 		// Load seat information
@@ -261,6 +382,8 @@ func loadMovies() {
 		loadedMovies = append(loadedMovies, movie)
 	}
 
+	loadSeatBlocks(loadedMovies)
+
 	// Replace the global movies slice
 	mutex.Lock()
 	movies = loadedMovies
@@ -277,70 +400,139 @@ func loadMovies() {
 
 // Add this new function that doesn't call loadMovies
 func createSampleMovies() {
+	// Sample showtimes are in the cinema's time zone
+	sampleShowtime := func(s string) time.Time {
+		t, _ := parseShowtime(s)
+		return t
+	}
+
 	// Create sample movies
 	sampleMovies := []Movie{
 		{
-			Title:    "Spider-Man: No Way Home",
-			Time:     "2023-08-01 18:00",
-			Duration: "2h 28m",
-			Price:    14.99,
-			Image:    "/static/images/movie_1.jpg",
+			Title:       "Spider-Man: No Way Home",
+			Time:        sampleShowtime("2023-08-01 18:00"),
+			Runtime:     148,
+			Price:       1499,
+			Image:       "/static/images/movie_1.jpg",
+			Genre:       "Action",
+			AgeRating:   "PG-13",
+			Synopsis:    "With his identity revealed, Peter Parker asks Doctor Strange for help, and a spell gone wrong opens the multiverse.",
+			Cast:        "Tom Holland, Zendaya, Benedict Cumberbatch",
+			Director:    "Jon Watts",
+			Language:    "English",
+			ReleaseDate: "2021-12-17",
 		},
 		{
-			Title:    "Dead Poets Society",
-			Time:     "2023-08-02 16:30",
-			Duration: "2h 8m",
-			Price:    11.99,
-			Image:    "/static/images/movie_2.jpg",
+			Title:       "Dead Poets Society",
+			Time:        sampleShowtime("2023-08-02 16:30"),
+			Runtime:     128,
+			Price:       1199,
+			Image:       "/static/images/movie_2.jpg",
+			Genre:       "Drama",
+			AgeRating:   "PG",
+			Synopsis:    "An unconventional English teacher inspires his students at a strict boarding school to seize the day.",
+			Cast:        "Robin Williams, Robert Sean Leonard, Ethan Hawke",
+			Director:    "Peter Weir",
+			Language:    "English",
+			ReleaseDate: "1989-06-02",
 		},
 		{
-			Title:    "The Shawshank Redemption",
-			Time:     "2023-08-03 19:15",
-			Duration: "2h 22m",
-			Price:    12.99,
-			Image:    "/static/images/movie_3.jpg",
+			Title:       "The Shawshank Redemption",
+			Time:        sampleShowtime("2023-08-03 16:45"),
+			Runtime:     142,
+			Price:       1299,
+			Image:       "/static/images/movie_3.jpg",
+			Genre:       "Drama",
+			AgeRating:   "R",
+			Synopsis:    "Two imprisoned men form a friendship over the years, finding solace and redemption through acts of common decency.",
+			Cast:        "Tim Robbins, Morgan Freeman",
+			Director:    "Frank Darabont",
+			Language:    "English",
+			ReleaseDate: "1994-09-23",
 		},
 		{
-			Title:    "Inception",
-			Time:     "2023-08-04 20:30",
-			Duration: "2h 28m",
-			Price:    13.99,
-			Image:    "/static/images/movie_4.jpg",
+			Title:       "Inception",
+			Time:        sampleShowtime("2023-08-04 20:30"),
+			Runtime:     148,
+			Price:       1399,
+			Image:       "/static/images/movie_4.jpg",
+			Genre:       "Science Fiction",
+			AgeRating:   "PG-13",
+			Synopsis:    "A thief who steals secrets through dream-sharing technology is given the chance to plant an idea instead.",
+			Cast:        "Leonardo DiCaprio, Joseph Gordon-Levitt, Elliot Page",
+			Director:    "Christopher Nolan",
+			Language:    "English",
+			ReleaseDate: "2010-07-16",
 		},
 		{
-			Title:    "The Matrix",
-			Time:     "2023-08-01 21:15",
-			Duration: "2h 16m",
-			Price:    12.99,
-			Image:    "/static/images/movie_5.jpg",
+			Title:       "The Matrix",
+			Time:        sampleShowtime("2023-08-01 21:15"),
+			Runtime:     136,
+			Price:       1299,
+			Image:       "/static/images/movie_5.jpg",
+			Genre:       "Science Fiction",
+			AgeRating:   "R",
+			Synopsis:    "A hacker learns that the world he lives in is a simulation and joins the rebellion against its machine creators.",
+			Cast:        "Keanu Reeves, Laurence Fishburne, Carrie-Anne Moss",
+			Director:    "Lana Wachowski, Lilly Wachowski",
+			Language:    "English",
+			ReleaseDate: "1999-03-31",
 		},
 		{
-			Title:    "Interstellar",
-			Time:     "2023-08-02 19:00",
-			Duration: "2h 49m",
-			Price:    15.99,
-			Image:    "/static/images/movie_6.jpg",
+			Title:       "Interstellar",
+			Time:        sampleShowtime("2023-08-02 19:00"),
+			Runtime:     169,
+			Price:       1599,
+			Image:       "/static/images/movie_6.jpg",
+			Genre:       "Science Fiction",
+			AgeRating:   "PG-13",
+			Synopsis:    "A team of explorers travels through a wormhole in search of a new home for humanity.",
+			Cast:        "Matthew McConaughey, Anne Hathaway, Jessica Chastain",
+			Director:    "Christopher Nolan",
+			Language:    "English",
+			ReleaseDate: "2014-11-07",
 		},
 		{
-			Title:    "Pulp Fiction",
-			Time:     "2023-08-03 20:00",
-			Duration: "2h 34m",
-			Price:    13.50,
-			Image:    "/static/images/movie_7.jpg",
+			Title:       "Pulp Fiction",
+			Time:        sampleShowtime("2023-08-03 20:00"),
+			Runtime:     154,
+			Price:       1350,
+			Image:       "/static/images/movie_7.jpg",
+			Genre:       "Crime",
+			AgeRating:   "R",
+			Synopsis:    "The lives of two hitmen, a boxer, a gangster and his wife intertwine in four tales of violence and redemption.",
+			Cast:        "John Travolta, Uma Thurman, Samuel L. Jackson",
+			Director:    "Quentin Tarantino",
+			Language:    "English",
+			ReleaseDate: "1994-10-14",
 		},
 		{
-			Title:    "The Dark Knight",
-			Time:     "2023-08-04 18:45",
-			Duration: "2h 32m",
-			Price:    14.50,
-			Image:    "/static/images/movie_8.jpg",
+			Title:       "The Dark Knight",
+			Time:        sampleShowtime("2023-08-04 17:30"),
+			Runtime:     152,
+			Price:       1450,
+			Image:       "/static/images/movie_8.jpg",
+			Genre:       "Action",
+			AgeRating:   "PG-13",
+			Synopsis:    "Batman faces the Joker, a criminal mastermind who plunges Gotham City into chaos.",
+			Cast:        "Christian Bale, Heath Ledger, Aaron Eckhart",
+			Director:    "Christopher Nolan",
+			Language:    "English",
+			ReleaseDate: "2008-07-18",
 		},
 		{
-			Title:    "Parasite",
-			Time:     "2023-08-05 17:30",
-			Duration: "2h 12m",
-			Price:    13.99,
-			Image:    "/static/images/movie_9.jpg",
+			Title:       "Parasite",
+			Time:        sampleShowtime("2023-08-05 17:30"),
+			Runtime:     132,
+			Price:       1399,
+			Image:       "/static/images/movie_9.jpg",
+			Genre:       "Thriller",
+			AgeRating:   "R",
+			Synopsis:    "A poor family schemes to become employed by a wealthy household, with unexpected consequences.",
+			Cast:        "Song Kang-ho, Lee Sun-kyun, Cho Yeo-jeong",
+			Director:    "Bong Joon-ho",
+			Language:    "Korean",
+			ReleaseDate: "2019-05-30",
 		},
 	}
 
@@ -352,18 +544,26 @@ func createSampleMovies() {
 		}
 	}
 
-	// Save sample movies to database
-	for i, movie := range sampleMovies {
-		movie.ID = i + 1 // Ensure sequential IDs
-		movie.Image = fmt.Sprintf("/static/images/movie_%d.jpg", movie.ID)
-		if err := saveMovie(&movie); err != nil {
+	// Save sample movies to database, through the same schedule check as
+	// the admin pages so the samples never double-book an auditorium.
+	// saveMovie inserts them and sets their IDs.
+	var saved []Movie
+	for i := range sampleMovies {
+		if err := checkSchedule(sampleMovies[i]); err != nil {
+			log.Printf("Skipping sample movie %q: %v", sampleMovies[i].Title, err)
+			continue
+		}
+		if err := saveMovie(&sampleMovies[i]); err != nil {
 			log.Println("Error saving sample movie:", err)
+			continue
 		}
+		saved = append(saved, sampleMovies[i])
 	}
+	loadSeatBlocks(saved)
 
 	// Update the movies slice directly
 	mutex.Lock()
-	movies = sampleMovies
+	movies = saved
 	mutex.Unlock()
 }
 
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const bookingsPerPage = 25
+
+// bookingSortColumns maps the sort parameter to a safe ORDER BY expression
+var bookingSortColumns = map[string]string{
+	"date":     "b.date",
+	"total":    "b.total_minor",
+	"customer": "b.name",
+	"movie":    "m.title",
+}
+
+// BookingFilter holds the admin bookings list filters from the query string
+type BookingFilter struct {
+	MovieID  int
+	From     string
+	To       string
+	Customer string
+	Status   string
+	Sort     string
+	Dir      string
+}
+
+// parseBookingFilter reads the filters from the request's query parameters
+func parseBookingFilter(r *http.Request) BookingFilter {
+	q := r.URL.Query()
+	f := BookingFilter{
+		From:     q.Get("from"),
+		To:       q.Get("to"),
+		Customer: strings.TrimSpace(q.Get("customer")),
+		Status:   q.Get("status"),
+		Sort:     q.Get("sort"),
+		Dir:      q.Get("dir"),
+	}
+	f.MovieID, _ = strconv.Atoi(q.Get("movie"))
+
+	if _, ok := bookingSortColumns[f.Sort]; !ok {
+		f.Sort = "date"
+	}
+	if f.Dir != "asc" {
+		f.Dir = "desc"
+	}
+	return f
+}
+
+// where builds the SQL conditions and arguments for the filter
+func (f BookingFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	if f.MovieID != 0 {
+		conds = append(conds, "b.movie_id = ?")
+		args = append(args, f.MovieID)
+	}
+	if f.From != "" {
+		conds = append(conds, "date(b.date) >= date(?)")
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		conds = append(conds, "date(b.date) <= date(?)")
+		args = append(args, f.To)
+	}
+	if f.Customer != "" {
+		conds = append(conds, "(b.name LIKE ? OR b.email LIKE ?)")
+		like := "%" + f.Customer + "%"
+		args = append(args, like, like)
+	}
+	if f.Status != "" {
+		conds = append(conds, "b.status = ?")
+		args = append(args, f.Status)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// SortURL links to the list sorted by column, flipping direction if it is already sorted by it
+func (f BookingFilter) SortURL(column string) string {
+	dir := "desc"
+	if f.Sort == column && f.Dir == "desc" {
+		dir = "asc"
+	}
+
+	q := url.Values{}
+	add := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if f.MovieID != 0 {
+		add("movie", strconv.Itoa(f.MovieID))
+	}
+	add("from", f.From)
+	add("to", f.To)
+	add("customer", f.Customer)
+	add("status", f.Status)
+	add("sort", column)
+	add("dir", dir)
+	return "?" + q.Encode()
+}
+
+// searchBookings returns one page of bookings matching the filter
+func searchBookings(f BookingFilter, page *Pagination) ([]Booking, error) {
+	where, args := f.where()
+
+	err := db.QueryRow("SELECT COUNT(*) FROM bookings b "+where, args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	order := bookingSortColumns[f.Sort] + " " + strings.ToUpper(f.Dir) + ", b.id " + strings.ToUpper(f.Dir)
+	rows, err := db.Query(`
+        SELECT b.id, b.user_id, b.name, b.email, b.movie_id, b.total_minor, b.currency, b.date, b.status, b.payment_method
+        FROM bookings b
+        LEFT JOIN movies m ON m.id = b.movie_id
+        `+where+`
+        ORDER BY `+order+`
+        LIMIT ? OFFSET ?
+    `, append(args, page.PerPage, page.Offset())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookings []Booking
+	for rows.Next() {
+		var b Booking
+		var userID sql.NullInt64
+		if err := rows.Scan(&b.ID, &userID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Currency, &b.Date, &b.Status, &b.PaymentMethod); err != nil {
+			log.Printf("Error scanning booking row: %v", err)
+			continue
+		}
+		if userID.Valid {
+			b.UserID = int(userID.Int64)
+		}
+		b.Seats = getBookingSeats(b.ID)
+		bookings = append(bookings, b)
+	}
+
+	return bookings, rows.Err()
+}
+
+// bulkBookingAction applies action to every selected booking, records each
+// change in the audit log and describes the outcome
+func bulkBookingAction(r *http.Request, actor User, action string, ids []int) (string, string) {
+	var done, failed int
+
+	for _, id := range ids {
+		var err error
+		switch action {
+		case "cancel", "refund":
+			status := bookingCancelled
+			if action == "refund" {
+				status = bookingRefunded
+			}
+
+			var previous string
+			mutex.Lock()
+			previous, err = cancelBooking(id, status)
+			mutex.Unlock()
+
+			if err == nil {
+				recordAudit(r, actor, "booking."+action, "booking", id,
+					map[string]string{"status": previous}, map[string]string{"status": status})
+			}
+		case "resend":
+			if err = sendBookingConfirmation(id); err == nil {
+				recordAudit(r, actor, "booking.resend", "booking", id, nil, nil)
+			}
+		default:
+			return "", "Unknown action"
+		}
+
+		if err != nil {
+			if err != errBookingNotActive {
+				log.Printf("Bulk %s of booking %d failed: %v", action, id, err)
+			}
+			failed++
+			continue
+		}
+		done++
+	}
+
+	verbs := map[string]string{"cancel": "Cancelled", "refund": "Refunded", "resend": "Resent confirmation for"}
+	message := fmt.Sprintf("%s %d booking(s)", verbs[action], done)
+	errMessage := ""
+	if failed > 0 {
+		errMessage = fmt.Sprintf("%d booking(s) could not be processed", failed)
+	}
+	return message, errMessage
+}
+
+// adminBookingsHandler lists bookings with filters, sorting and pagination,
+// and runs bulk actions on the selected bookings
+func adminBookingsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+
+	var message, actionError string
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			httpError(w, r, http.StatusBadRequest, "Error parsing form")
+			return
+		}
+
+		var ids []int
+		for _, v := range r.PostForm["ids"] {
+			if id, err := strconv.Atoi(v); err == nil {
+				ids = append(ids, id)
+			}
+		}
+
+		if len(ids) == 0 {
+			actionError = "Select at least one booking"
+		} else {
+			message, actionError = bulkBookingAction(r, user, r.PostFormValue("action"), ids)
+		}
+	}
+
+	filter := parseBookingFilter(r)
+	page := newPagination(r, bookingsPerPage)
+
+	bookings, err := searchBookings(filter, &page)
+	if err != nil {
+		serverError(w, r, fmt.Errorf("loading bookings: %w", err))
+		return
+	}
+
+	data := struct {
+		User       User
+		Bookings   []Booking
+		Movies     []Movie
+		Filter     BookingFilter
+		Statuses   []string
+		Pagination Pagination
+		Message    string
+		Error      string
+	}{
+		User:       user,
+		Bookings:   bookings,
+		Movies:     movies,
+		Filter:     filter,
+		Statuses:   []string{bookingConfirmed, bookingCancelled, bookingRefunded},
+		Pagination: page,
+		Message:    message,
+		Error:      actionError,
+	}
+
+	err = templates.Render(w, r, "admin_bookings", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
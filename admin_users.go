@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usersPerPage = 20
+
+// AdminUserRow is one line of the admin user list
+type AdminUserRow struct {
+	User
+	BookingCount int
+}
+
+// searchUsers returns one page of users whose name or email contains query
+func searchUsers(query string, page *Pagination) ([]AdminUserRow, error) {
+	where := ""
+	var args []interface{}
+	if query != "" {
+		where = "WHERE u.name LIKE ? OR u.email LIKE ?"
+		like := "%" + query + "%"
+		args = append(args, like, like)
+	}
+
+	err := db.QueryRow("SELECT COUNT(*) FROM users u "+where, args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+        SELECT u.id, u.name, u.email, u.is_admin, u.is_staff, u.totp_enabled, u.disabled, u.date_created,
+            (SELECT COUNT(*) FROM bookings b WHERE b.user_id = u.id)
+        FROM users u `+where+`
+        ORDER BY u.date_created DESC, u.id DESC
+        LIMIT ? OFFSET ?
+    `, append(args, page.PerPage, page.Offset())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []AdminUserRow
+	for rows.Next() {
+		var u AdminUserRow
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.IsAdmin, &u.IsStaff, &u.TOTPEnabled, &u.Disabled, &u.DateCreated, &u.BookingCount); err != nil {
+			log.Printf("Error scanning user row: %v", err)
+			continue
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// countActiveAdmins returns how many enabled admin accounts exist
+func countActiveAdmins() (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin = 1 AND disabled = 0").Scan(&count)
+	return count, err
+}
+
+// endUserSessions signs the user out everywhere and revokes their API tokens
+func endUserSessions(tx *sql.Tx, userID int) error {
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		"UPDATE api_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		time.Now(), userID,
+	)
+	return err
+}
+
+// updateUser applies an admin edit to the user's profile and roles
+func updateUser(actor User, userID int, name, email string, isAdmin, isStaff bool) error {
+	name = strings.TrimSpace(name)
+	email = strings.TrimSpace(email)
+	if name == "" || email == "" {
+		return errors.New("name and email are required")
+	}
+
+	target, err := getUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if target.IsAdmin && !isAdmin {
+		if actor.ID == userID {
+			return errors.New("you cannot remove your own admin rights")
+		}
+		if count, err := countActiveAdmins(); err != nil || (count <= 1 && !target.Disabled) {
+			return errors.New("at least one active admin is required")
+		}
+	}
+
+	var existing int
+	err = db.QueryRow("SELECT id FROM users WHERE email = ? AND id != ?", email, userID).Scan(&existing)
+	if err == nil {
+		return errors.New("another user already has this email")
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = db.Exec(
+		"UPDATE users SET name = ?, email = ?, is_admin = ?, is_staff = ? WHERE id = ?",
+		name, email, isAdmin, isStaff, userID,
+	)
+	return err
+}
+
+// setUserDisabled disables or re-enables an account. Disabling ends all of
+// the user's sessions and revokes their API tokens.
+func setUserDisabled(actor User, userID int, disabled bool) error {
+	if disabled && actor.ID == userID {
+		return errors.New("you cannot disable your own account")
+	}
+
+	target, err := getUser(userID)
+	if err != nil {
+		return err
+	}
+	if disabled && target.IsAdmin && !target.Disabled {
+		if count, err := countActiveAdmins(); err != nil || count <= 1 {
+			return errors.New("at least one active admin is required")
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET disabled = ? WHERE id = ?", disabled, userID); err != nil {
+		return err
+	}
+	if disabled {
+		if err := endUserSessions(tx, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deleteUser removes an account and everything tied to it. Bookings are kept
+// for the records but no longer point at the user.
+func deleteUser(actor User, userID int) error {
+	if actor.ID == userID {
+		return errors.New("you cannot delete your own account")
+	}
+
+	target, err := getUser(userID)
+	if err != nil {
+		return err
+	}
+	if target.IsAdmin && !target.Disabled {
+		if count, err := countActiveAdmins(); err != nil || count <= 1 {
+			return errors.New("at least one active admin is required")
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"DELETE FROM sessions WHERE user_id = ?",
+		"DELETE FROM api_tokens WHERE user_id = ?",
+		"DELETE FROM recovery_codes WHERE user_id = ?",
+		"DELETE FROM user_identities WHERE user_id = ?",
+		"UPDATE bookings SET user_id = NULL WHERE user_id = ?",
+		"DELETE FROM users WHERE id = ?",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// getUserBookings returns every booking made by or for the user
+func getUserBookings(user User) ([]Booking, error) {
+	rows, err := db.Query(`
+        SELECT id, name, email, movie_id, total_minor, currency, date, status
+        FROM bookings
+        WHERE user_id = ? OR email = ?
+        ORDER BY date DESC
+    `, user.ID, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookings []Booking
+	for rows.Next() {
+		var b Booking
+		if err := rows.Scan(&b.ID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Currency, &b.Date, &b.Status); err != nil {
+			log.Printf("Error scanning booking row: %v", err)
+			continue
+		}
+		b.UserID = user.ID
+		b.Seats = getBookingSeats(b.ID)
+		bookings = append(bookings, b)
+	}
+
+	return bookings, rows.Err()
+}
+
+// adminUsersHandler lists and searches users
+func adminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	page := newPagination(r, usersPerPage)
+
+	users, err := searchUsers(query, &page)
+	if err != nil {
+		serverError(w, r, fmt.Errorf("loading users: %w", err))
+		return
+	}
+
+	data := struct {
+		User       User
+		Users      []AdminUserRow
+		Query      string
+		Pagination Pagination
+	}{
+		User:       user,
+		Users:      users,
+		Query:      query,
+		Pagination: page,
+	}
+
+	err = templates.Render(w, r, "admin_users", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// adminUserHandler shows one user with their bookings and handles edits,
+// role changes, disabling and deletion
+func adminUserHandler(w http.ResponseWriter, r *http.Request) {
+	actor, _ := getUserFromSession(r)
+
+	id, err := strconv.Atoi(strings.Trim(r.URL.Path[len("/admin/users/"):], "/"))
+	if err != nil {
+		httpError(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var actionError, message string
+	if r.Method == http.MethodPost {
+		before, err := getUser(id)
+		if err == sql.ErrNoRows {
+			httpError(w, r, http.StatusNotFound, "User not found")
+			return
+		}
+
+		action := r.FormValue("action")
+		switch action {
+		case "update":
+			err = updateUser(actor, id, r.FormValue("name"), r.FormValue("email"), r.FormValue("is_admin") == "1", r.FormValue("is_staff") == "1")
+			message = "User updated"
+		case "disable":
+			err = setUserDisabled(actor, id, true)
+			message = "Account disabled and signed out everywhere"
+		case "enable":
+			err = setUserDisabled(actor, id, false)
+			message = "Account enabled"
+		case "delete":
+			if err = deleteUser(actor, id); err == nil {
+				recordAudit(r, actor, "user.delete", "user", id, auditUser(before), nil)
+				http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+				return
+			}
+		default:
+			httpError(w, r, http.StatusBadRequest, "Unknown action")
+			return
+		}
+		if err != nil {
+			actionError = err.Error()
+			message = ""
+		} else if after, err := getUser(id); err == nil {
+			recordAudit(r, actor, "user."+action, "user", id, auditUser(before), auditUser(after))
+		}
+	}
+
+	target, err := getUser(id)
+	if err == sql.ErrNoRows {
+		httpError(w, r, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		serverError(w, r, fmt.Errorf("loading user: %w", err))
+		return
+	}
+
+	bookings, err := getUserBookings(target)
+	if err != nil {
+		log.Printf("Error loading bookings for user %d: %v", id, err)
+	}
+
+	data := struct {
+		User     User
+		Target   User
+		Bookings []Booking
+		Error    string
+		Message  string
+	}{
+		User:     actor,
+		Target:   target,
+		Bookings: bookings,
+		Error:    actionError,
+		Message:  message,
+	}
+
+	err = templates.Render(w, r, "admin_user", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// writeJSON sends v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
+
+// writeJSONError sends an error message in the API's JSON error format
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// apiBookingsHandler lists the caller's bookings, or all bookings for admins
+func apiBookingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user, _ := requestUser(r)
+	bookings, err := listBookings(user)
+	if err != nil {
+		serverError(w, r, fmt.Errorf("loading bookings: %w", err))
+		return
+	}
+	if bookings == nil {
+		bookings = []Booking{}
+	}
+
+	writeJSON(w, http.StatusOK, bookings)
+}
+
+// apiMoviesHandler lists movies publicly and creates movies for tokens with movies:write
+func apiMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		mutex.Lock()
+		list := append([]Movie{}, movies...)
+		mutex.Unlock()
+		writeJSON(w, http.StatusOK, list)
+	case http.MethodPost:
+		apiMiddleware(scopeMoviesWrite, apiSaveMovieHandler)(w, r)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// apiMovieHandler updates or deletes the movie at /api/movies/{id}
+func apiMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.Trim(r.URL.Path[len("/api/movies/"):], "/"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid movie ID")
+		return
+	}
+
+	if getMovie(id) == nil {
+		writeJSONError(w, http.StatusNotFound, "Movie not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		apiSaveMovieHandler(w, r)
+	case http.MethodDelete:
+		before := *getMovie(id)
+		if err := deleteMovie(id); err != nil {
+			serverError(w, r, fmt.Errorf("deleting movie %d: %w", id, err))
+			return
+		}
+		user, _ := requestUser(r)
+		recordAudit(r, user, "movie.delete", "movie", id, before, nil)
+		loadMovies()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// apiSaveMovieHandler creates a movie from a POST body or replaces one from a PUT body
+func apiSaveMovieHandler(w http.ResponseWriter, r *http.Request) {
+	var movie Movie
+	if err := json.NewDecoder(r.Body).Decode(&movie); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request data")
+		return
+	}
+
+	movie.ID = 0
+	var before *Movie
+	if r.Method == http.MethodPut {
+		movie.ID, _ = strconv.Atoi(strings.Trim(r.URL.Path[len("/api/movies/"):], "/"))
+
+		if existing := getMovie(movie.ID); existing != nil {
+			copied := *existing
+			before = &copied
+
+			// Keep the current poster, and its uploaded renditions, unless
+			// a new image URL is given
+			if movie.Image == "" || movie.Image == existing.Image {
+				movie.Image = existing.Image
+				movie.Poster = existing.Poster
+			}
+			if movie.Currency == "" {
+				movie.Currency = existing.Currency
+			}
+		}
+	}
+
+	if movie.Title == "" || movie.Time.IsZero() || movie.Runtime <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "title, time and runtime are required")
+		return
+	}
+	movie.Time = movie.Time.UTC()
+
+	if err := normalizeMovieDetails(&movie); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := checkSchedule(movie); err != nil {
+		status := http.StatusBadRequest
+		var conflict ScheduleConflictError
+		if errors.As(err, &conflict) {
+			status = http.StatusConflict
+		}
+		writeJSONError(w, status, err.Error())
+		return
+	}
+
+	if err := saveMovie(&movie); err != nil {
+		serverError(w, r, fmt.Errorf("saving movie: %w", err))
+		return
+	}
+	if before != nil && before.Poster != movie.Poster {
+		removePoster(before.Poster)
+	}
+
+	user, _ := requestUser(r)
+	if before != nil {
+		recordAudit(r, user, "movie.update", "movie", movie.ID, before, movie)
+	} else {
+		recordAudit(r, user, "movie.create", "movie", movie.ID, nil, movie)
+	}
+	loadMovies()
+
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, getMovie(movie.ID))
+}
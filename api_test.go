@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// attachTestPoster stores renditions for the movie as an upload would and
+// returns the poster reference
+func attachTestPoster(t *testing.T, movie Movie) string {
+	t.Helper()
+	renditions := map[string][]byte{}
+	for _, size := range posterSizes {
+		renditions[size.Name] = []byte("jpeg " + size.Name)
+	}
+	ref, err := savePoster(context.Background(), movie.ID, &Poster{Key: "test", Renditions: renditions})
+	if err != nil {
+		t.Fatalf("savePoster: %v", err)
+	}
+	if _, err := db.Exec("UPDATE movies SET image = ?, poster = ? WHERE id = ?", posterURL(ref, "card"), ref, movie.ID); err != nil {
+		t.Fatal(err)
+	}
+	loadMovies()
+	return ref
+}
+
+func posterStored(ref string) bool {
+	_, err := os.Stat(filepath.Join(uploadDir, filepath.FromSlash(posterKey(ref, "card"))))
+	return err == nil
+}
+
+func TestAPIUpdateKeepsPoster(t *testing.T) {
+	site := newTestSite(t)
+	admin := createTestUser(t, "admin@example.com", true, false)
+	token := createTestToken(t, admin, scopeMoviesWrite)
+	movie := createTestMovie(t, "Poster Premiere")
+	ref := attachTestPoster(t, movie)
+
+	update := func(changes map[string]interface{}) Movie {
+		t.Helper()
+		body := map[string]interface{}{
+			"title":    movie.Title,
+			"time":     movie.Time,
+			"runtime":  movie.Runtime,
+			"price":    movie.Price,
+			"currency": movie.Currency,
+		}
+		for k, v := range changes {
+			body[k] = v
+		}
+		data, _ := json.Marshal(body)
+		w := apiRequest(site, http.MethodPut, "/api/movies/"+strconv.Itoa(movie.ID), token, string(data))
+		if w.Code != http.StatusOK {
+			t.Fatalf("PUT: status %d %s", w.Code, w.Body)
+		}
+		return *getMovie(movie.ID)
+	}
+
+	updated := update(map[string]interface{}{"title": "Poster Premiere (Director's Cut)"})
+	if updated.Poster != ref || updated.PosterSrcset() == "" {
+		t.Errorf("poster after a title change = %q, want %q", updated.Poster, ref)
+	}
+	if !posterStored(ref) {
+		t.Error("the poster's files were removed")
+	}
+
+	// Sending back the image URL the API returned keeps the poster too
+	updated = update(map[string]interface{}{"image": updated.Image})
+	if updated.Poster != ref {
+		t.Errorf("poster after resending its image = %q, want %q", updated.Poster, ref)
+	}
+
+	// A new image URL replaces the upload and its files
+	updated = update(map[string]interface{}{"image": "https://images.example.com/new.jpg"})
+	if updated.Poster != "" || updated.PosterURL("card") != "https://images.example.com/new.jpg" {
+		t.Errorf("after a new image: poster %q, URL %q", updated.Poster, updated.PosterURL("card"))
+	}
+	if posterStored(ref) {
+		t.Error("the replaced poster's files were left behind")
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const auditPerPage = 50
+
+// AuditEntry is one recorded admin or privileged action
+type AuditEntry struct {
+	ID         int       `json:"id"`
+	Time       time.Time `json:"time"`
+	UserID     int       `json:"userID,omitempty"`
+	UserEmail  string    `json:"user"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"targetType"`
+	TargetID   string    `json:"targetID"`
+	Before     string    `json:"before,omitempty"`
+	After      string    `json:"after,omitempty"`
+	IP         string    `json:"ip"`
+}
+
+// clientIP returns the address the request came from. X-Forwarded-For is
+// only trusted when MOOBEE_TRUST_PROXY is set, as clients can forge it.
+func clientIP(r *http.Request) string {
+	if r == nil {
+		return "cli"
+	}
+	if envOr("MOOBEE_TRUST_PROXY", "") != "" {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// auditJSON encodes a before or after snapshot, leaving nil values empty
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// recordAudit appends an entry to the audit log. r is nil for actions run
+// from the command line. Failures are logged rather than undoing the action.
+func recordAudit(r *http.Request, actor User, action, targetType string, targetID interface{}, before, after interface{}) {
+	var userID interface{}
+	if actor.ID != 0 {
+		userID = actor.ID
+	}
+
+	_, err := db.Exec(`
+        INSERT INTO audit_log (user_id, user_email, action, target_type, target_id, before, after, ip)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `, userID, actor.Email, action, targetType, fmt.Sprint(targetID), auditJSON(before), auditJSON(after), clientIP(r))
+	if err != nil {
+		log.Printf("Error writing audit log entry %s %s/%v: %v", action, targetType, targetID, err)
+	}
+}
+
+// auditUser is the part of a user recorded in the audit log, leaving out
+// credentials
+func auditUser(u User) map[string]interface{} {
+	return map[string]interface{}{
+		"name":       u.Name,
+		"email":      u.Email,
+		"is_admin":   u.IsAdmin,
+		"is_staff":   u.IsStaff,
+		"two_factor": u.TOTPEnabled,
+		"disabled":   u.Disabled,
+	}
+}
+
+// AuditFilter holds the audit log search from the query string
+type AuditFilter struct {
+	Query  string
+	Action string
+	From   string
+	To     string
+}
+
+// parseAuditFilter reads the search from the request's query parameters
+func parseAuditFilter(r *http.Request) AuditFilter {
+	q := r.URL.Query()
+	return AuditFilter{
+		Query:  strings.TrimSpace(q.Get("q")),
+		Action: q.Get("action"),
+		From:   q.Get("from"),
+		To:     q.Get("to"),
+	}
+}
+
+// where builds the SQL conditions and arguments for the filter
+func (f AuditFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	if f.Query != "" {
+		conds = append(conds, "(user_email LIKE ? OR target_id = ? OR before LIKE ? OR after LIKE ? OR ip = ?)")
+		like := "%" + f.Query + "%"
+		args = append(args, like, f.Query, like, like, f.Query)
+	}
+	if f.Action != "" {
+		conds = append(conds, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.From != "" {
+		conds = append(conds, "date(created_at) >= date(?)")
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		conds = append(conds, "date(created_at) <= date(?)")
+		args = append(args, f.To)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// ExportURL links to a download of every entry matching the filter
+func (f AuditFilter) ExportURL(format string) string {
+	q := url.Values{}
+	add := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	add("q", f.Query)
+	add("action", f.Action)
+	add("from", f.From)
+	add("to", f.To)
+	add("export", format)
+	return "?" + q.Encode()
+}
+
+// searchAuditLog returns matching entries, newest first. A nil page returns
+// every match, for exports.
+func searchAuditLog(f AuditFilter, page *Pagination) ([]AuditEntry, error) {
+	where, args := f.where()
+
+	limit := ""
+	if page != nil {
+		err := db.QueryRow("SELECT COUNT(*) FROM audit_log "+where, args...).Scan(&page.Total)
+		if err != nil {
+			return nil, err
+		}
+		limit = "LIMIT ? OFFSET ?"
+		args = append(args, page.PerPage, page.Offset())
+	}
+
+	rows, err := db.Query(`
+        SELECT id, created_at, COALESCE(user_id, 0), user_email, action, target_type, target_id, before, after, ip
+        FROM audit_log `+where+`
+        ORDER BY id DESC `+limit, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Time, &e.UserID, &e.UserEmail, &e.Action, &e.TargetType, &e.TargetID, &e.Before, &e.After, &e.IP); err != nil {
+			log.Printf("Error scanning audit row: %v", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// auditActions lists the distinct actions recorded so far for the filter menu
+func auditActions() []string {
+	rows, err := db.Query("SELECT DISTINCT action FROM audit_log ORDER BY action")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var actions []string
+	for rows.Next() {
+		var a string
+		if rows.Scan(&a) == nil {
+			actions = append(actions, a)
+		}
+	}
+	return actions
+}
+
+// adminAuditHandler searches the audit log, or exports the matching
+// entries as CSV or JSON when ?export= is set
+func adminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+	filter := parseAuditFilter(r)
+
+	if format := r.URL.Query().Get("export"); format != "" {
+		entries, err := searchAuditLog(filter, nil)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("loading audit log: %w", err))
+			return
+		}
+		writeAuditExport(w, r, entries, format)
+		return
+	}
+
+	page := newPagination(r, auditPerPage)
+	entries, err := searchAuditLog(filter, &page)
+	if err != nil {
+		serverError(w, r, fmt.Errorf("loading audit log: %w", err))
+		return
+	}
+
+	data := struct {
+		User       User
+		Entries    []AuditEntry
+		Actions    []string
+		Filter     AuditFilter
+		Pagination Pagination
+	}{
+		User:       user,
+		Entries:    entries,
+		Actions:    auditActions(),
+		Filter:     filter,
+		Pagination: page,
+	}
+
+	err = templates.Render(w, r, "admin_audit", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// writeAuditExport sends audit entries as a CSV or JSON download
+func writeAuditExport(w http.ResponseWriter, r *http.Request, entries []AuditEntry, format string) {
+	filename := "moobee-audit-" + time.Now().UTC().Format("20060102-150405")
+
+	switch format {
+	case "json":
+		if entries == nil {
+			entries = []AuditEntry{}
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		writeJSON(w, http.StatusOK, entries)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"ID", "Time", "User ID", "User", "Action", "Target Type", "Target ID", "Before", "After", "IP"})
+		for _, e := range entries {
+			cw.Write([]string{
+				strconv.Itoa(e.ID), e.Time.UTC().Format(time.RFC3339), strconv.Itoa(e.UserID), e.UserEmail,
+				e.Action, e.TargetType, e.TargetID, e.Before, e.After, e.IP,
+			})
+		}
+		cw.Flush()
+	default:
+		httpError(w, r, http.StatusBadRequest, "Unknown export format")
+	}
+}
@@ -17,9 +17,20 @@ type User struct {
 	Email       string
 	Password    string
 	IsAdmin     bool
+	IsStaff     bool
+	TOTPEnabled bool
+	Disabled    bool
+	Locale      string // chosen language, or empty to follow the browser
 	DateCreated time.Time
 }
 
+const (
+	sessionDuration    = 24 * time.Hour
+	mfaPendingDuration = 5 * time.Minute
+)
+
+var errAccountDisabled = errors.New("this account has been disabled")
+
 func generateToken() (string, error) {
 	b := make([]byte, 32)
 	_, err := rand.Read(b)
@@ -76,51 +87,134 @@ func registerUser(name, email, password string) (int, error) {
 	return int(lastID), nil
 }
 
-func loginUser(email, password string) (string, int, error) {
+// loginUser checks the user's password and opens a session. When the account
+// has two-factor authentication enabled the session is created pending, and
+// getUserFromSession will not accept it until completeMFALogin succeeds.
+func loginUser(email, password string) (string, int, bool, error) {
 	// Find user
 	var user User
 	err := db.QueryRow(
-		"SELECT id, password FROM users WHERE email = ?",
+		"SELECT id, password, totp_enabled, disabled FROM users WHERE email = ?",
 		email,
-	).Scan(&user.ID, &user.Password)
+	).Scan(&user.ID, &user.Password, &user.TOTPEnabled, &user.Disabled)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", 0, errors.New("invalid email or password")
+			return "", 0, false, errors.New("invalid email or password")
 		}
-		return "", 0, err
+		return "", 0, false, err
 	}
 
 	// Check password
 	if !comparePasswords(user.Password, password) {
-		return "", 0, errors.New("invalid email or password")
+		return "", 0, false, errors.New("invalid email or password")
+	}
+
+	if user.Disabled {
+		return "", 0, false, errAccountDisabled
+	}
+
+	token, err := createSession(user.ID, user.TOTPEnabled)
+	if err != nil {
+		return "", 0, false, err
 	}
 
+	return token, user.ID, user.TOTPEnabled, nil
+}
+
+// createSession stores a new session for the user and returns its token.
+// Pending sessions are short-lived and only good for the second login step.
+func createSession(userID int, mfaPending bool) (string, error) {
 	// Generate session token
 	token, err := generateToken()
 	if err != nil {
-		return "", 0, err
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(sessionDuration)
+	if mfaPending {
+		expiresAt = time.Now().Add(mfaPendingDuration)
 	}
 
-	// Create session
-	expiresAt := time.Now().Add(24 * time.Hour) // 24-hour session
 	_, err = db.Exec(
-		"INSERT INTO sessions (user_id, token, expires_at) VALUES (?, ?, ?)",
-		user.ID, token, expiresAt,
+		"INSERT INTO sessions (user_id, token, expires_at, mfa_pending) VALUES (?, ?, ?, ?)",
+		userID, token, expiresAt, mfaPending,
 	)
 	if err != nil {
-		return "", 0, err
+		return "", err
 	}
 
-	return token, user.ID, nil
+	return token, nil
+}
+
+// getPendingMFAUser returns the user whose pending session cookie is on the request
+func getPendingMFAUser(r *http.Request) (User, string, error) {
+	sessionToken, err := r.Cookie("session")
+	if err != nil {
+		return User{}, "", err
+	}
+
+	var userID int
+	err = db.QueryRow(
+		"SELECT user_id FROM sessions WHERE token = ? AND expires_at > ? AND mfa_pending = 1",
+		sessionToken.Value, time.Now(),
+	).Scan(&userID)
+	if err != nil {
+		return User{}, "", err
+	}
+
+	user, err := getUser(userID)
+	return user, sessionToken.Value, err
+}
+
+// completeMFALogin replaces a pending session with a full one once the
+// second factor has been verified
+func completeMFALogin(pendingToken string, userID int) (string, error) {
+	_, err := db.Exec("DELETE FROM sessions WHERE token = ?", pendingToken)
+	if err != nil {
+		return "", err
+	}
+	return createSession(userID, false)
+}
+
+// recordMFAFailure counts a wrong code against the pending session and
+// deletes the session once maxMFAAttempts is reached, so codes can't be
+// guessed within its lifetime. It reports whether the session was deleted.
+func recordMFAFailure(pendingToken string) (bool, error) {
+	_, err := db.Exec("UPDATE sessions SET mfa_failures = mfa_failures + 1 WHERE token = ? AND mfa_pending = 1", pendingToken)
+	if err != nil {
+		return false, err
+	}
+	var failures int
+	err = db.QueryRow("SELECT mfa_failures FROM sessions WHERE token = ?", pendingToken).Scan(&failures)
+	if err != nil {
+		return false, err
+	}
+	if failures < maxMFAAttempts {
+		return false, nil
+	}
+
+	_, err = db.Exec("DELETE FROM sessions WHERE token = ?", pendingToken)
+	return err == nil, err
+}
+
+// setSessionCookie writes the session cookie for token
+func setSessionCookie(w http.ResponseWriter, token string, duration time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(duration),
+		HttpOnly: true,
+	})
 }
 
 func getUser(userID int) (User, error) {
 	var user User
 	err := db.QueryRow(
-		"SELECT id, name, email, is_admin, date_created FROM users WHERE id = ?",
+		"SELECT id, name, email, is_admin, is_staff, totp_enabled, disabled, locale, date_created FROM users WHERE id = ?",
 		userID,
-	).Scan(&user.ID, &user.Name, &user.Email, &user.IsAdmin, &user.DateCreated)
+	).Scan(&user.ID, &user.Name, &user.Email, &user.IsAdmin, &user.IsStaff, &user.TOTPEnabled, &user.Disabled, &user.Locale, &user.DateCreated)
 
 	return user, err
 }
@@ -132,10 +226,11 @@ func getUserFromSession(r *http.Request) (User, error) {
 	}
 
 	var userID int
-	err = db.QueryRow(
-		"SELECT user_id FROM sessions WHERE token = ? AND expires_at > ?",
-		sessionToken.Value, time.Now(),
-	).Scan(&userID)
+	err = db.QueryRow(`
+        SELECT s.user_id FROM sessions s
+        JOIN users u ON u.id = s.user_id
+        WHERE s.token = ? AND s.expires_at > ? AND s.mfa_pending = 0 AND u.disabled = 0
+    `, sessionToken.Value, time.Now()).Scan(&userID)
 
 	if err != nil {
 		return User{}, err
@@ -157,20 +252,38 @@ func isAdmin(r *http.Request) bool {
 	return user.IsAdmin
 }
 
-func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !isAuthenticated(r) {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		user, err := getUserFromSession(r)
+		if err != nil || !user.IsAdmin {
+			httpError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		// Admins must enroll in 2FA before using admin pages when the policy is on
+		if !user.TOTPEnabled && adminRequires2FA() {
+			http.Redirect(w, r, "/profile?require2fa=1", http.StatusSeeOther)
 			return
 		}
 		next(w, r)
 	}
 }
 
-func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// staffMiddleware lets box-office staff and admins through
+func staffMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !isAdmin(r) {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		user, err := getUserFromSession(r)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if !user.IsAdmin && !user.IsStaff {
+			httpError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if user.IsAdmin && !user.TOTPEnabled && adminRequires2FA() {
+			http.Redirect(w, r, "/profile?require2fa=1", http.StatusSeeOther)
 			return
 		}
 		next(w, r)
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxLogoSize limits uploaded brand logos
+const maxLogoSize = 1 << 20
+
+// logoTypes are the image formats accepted as logos, by sniffed content type,
+// with the extension they are stored under. SVG is left out because it can
+// carry scripts.
+var logoTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var (
+	colorPattern = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+	fontPattern  = regexp.MustCompile(`^[A-Za-z0-9 ]+$`)
+)
+
+// Brand is one cinema brand served by the site. Requests are matched to a
+// brand by host name; anything unmatched gets the default brand.
+type Brand struct {
+	ID           int
+	Name         string
+	Hosts        string // comma-separated host names, without ports
+	Logo         string // asset store key, empty to show the name instead
+	PrimaryColor string // colours are #rrggbb
+	AccentColor  string // second colour of the header gradient
+	SuccessColor string
+	TextColor    string
+	SurfaceColor string // light backgrounds such as the navigation bar
+	Font         string // a Google Fonts family
+	FooterText   string // empty for the usual copyright line
+	IsDefault    bool
+}
+
+// defaultBrand is the original Moobee look, used to seed the brands table
+// and whenever no brand has been loaded
+var defaultBrand = Brand{
+	Name:         "Moobee",
+	PrimaryColor: "#ff4757",
+	AccentColor:  "#ff6b81",
+	SuccessColor: "#2ed573",
+	TextColor:    "#2f3542",
+	SurfaceColor: "#f1f2f6",
+	Font:         "Poppins",
+	IsDefault:    true,
+}
+
+// brands is the cached contents of the brands table, default brand first
+var (
+	brandsMu sync.RWMutex
+	brands   []Brand
+)
+
+const brandColumns = `id, name, hosts, logo, primary_color, accent_color, success_color,
+    text_color, surface_color, font, footer_text, is_default`
+
+// LogoURL is where the brand's logo is served from, if it has one
+func (b Brand) LogoURL() string {
+	if b.Logo == "" {
+		return ""
+	}
+	return assets.URL(b.Logo)
+}
+
+// HostList is the brand's host names as a list
+func (b Brand) HostList() []string {
+	var hosts []string
+	for _, h := range strings.Split(b.Hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// seedDefaultBrand creates the default brand on first start
+func seedDefaultBrand() error {
+	b := defaultBrand
+	_, err := db.Exec(`
+        INSERT INTO brands (name, hosts, logo, primary_color, accent_color, success_color,
+            text_color, surface_color, font, footer_text, is_default)
+        SELECT ?, '', '', ?, ?, ?, ?, ?, ?, '', 1
+        WHERE NOT EXISTS (SELECT 1 FROM brands)
+    `, b.Name, b.PrimaryColor, b.AccentColor, b.SuccessColor, b.TextColor, b.SurfaceColor, b.Font)
+	return err
+}
+
+// loadBrands refreshes the cached brands from the database
+func loadBrands() {
+	rows, err := db.Query("SELECT " + brandColumns + " FROM brands ORDER BY is_default DESC, name")
+	if err != nil {
+		log.Printf("Error loading brands: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var loaded []Brand
+	for rows.Next() {
+		var b Brand
+		err := rows.Scan(&b.ID, &b.Name, &b.Hosts, &b.Logo, &b.PrimaryColor, &b.AccentColor, &b.SuccessColor,
+			&b.TextColor, &b.SurfaceColor, &b.Font, &b.FooterText, &b.IsDefault)
+		if err != nil {
+			log.Printf("Error scanning brand: %v", err)
+			continue
+		}
+		loaded = append(loaded, b)
+	}
+
+	brandsMu.Lock()
+	brands = loaded
+	brandsMu.Unlock()
+}
+
+// listBrands returns the cached brands, default brand first
+func listBrands() []Brand {
+	brandsMu.RLock()
+	defer brandsMu.RUnlock()
+	return append([]Brand(nil), brands...)
+}
+
+// brandByID returns the cached brand, or the default brand if it is gone
+func brandByID(id int) Brand {
+	brandsMu.RLock()
+	defer brandsMu.RUnlock()
+	for _, b := range brands {
+		if b.ID == id {
+			return b
+		}
+	}
+	if len(brands) > 0 {
+		return brands[0]
+	}
+	return defaultBrand
+}
+
+// requestBrand picks the brand whose hosts include the request's host name
+func requestBrand(r *http.Request) Brand {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	brandsMu.RLock()
+	defer brandsMu.RUnlock()
+	for _, b := range brands {
+		for _, h := range b.HostList() {
+			if h == host {
+				return b
+			}
+		}
+	}
+	if len(brands) > 0 {
+		return brands[0]
+	}
+	return defaultBrand
+}
+
+// Colors are the brand's colours in the order of the admin form
+func (b Brand) Colors() []string {
+	return []string{b.PrimaryColor, b.AccentColor, b.SuccessColor, b.TextColor, b.SurfaceColor}
+}
+
+// normalizeBrand tidies the form input and checks it
+func normalizeBrand(b *Brand) error {
+	b.Name = strings.TrimSpace(b.Name)
+	if b.Name == "" {
+		return errors.New("the brand needs a name")
+	}
+
+	var hosts []string
+	for _, h := range strings.FieldsFunc(strings.ToLower(b.Hosts), func(r rune) bool { return r == ',' || r == ' ' || r == '\n' }) {
+		if host, _, err := net.SplitHostPort(h); err == nil {
+			h = host
+		}
+		hosts = append(hosts, h)
+	}
+	b.Hosts = strings.Join(hosts, ", ")
+
+	for _, c := range []*string{&b.PrimaryColor, &b.AccentColor, &b.SuccessColor, &b.TextColor, &b.SurfaceColor} {
+		*c = strings.ToLower(strings.TrimSpace(*c))
+		if !colorPattern.MatchString(*c) {
+			return errors.New("colours must look like #ff4757")
+		}
+	}
+
+	b.Font = strings.TrimSpace(b.Font)
+	if b.Font == "" {
+		b.Font = defaultBrand.Font
+	}
+	if len(b.Font) > 40 || !fontPattern.MatchString(b.Font) {
+		return errors.New("the font must be a Google Fonts family name such as Poppins")
+	}
+
+	b.FooterText = strings.TrimSpace(b.FooterText)
+	if len(b.FooterText) > 200 {
+		return errors.New("the footer text must be at most 200 characters")
+	}
+	return nil
+}
+
+// checkBrandHosts makes sure no other brand already answers on the hosts
+func checkBrandHosts(b Brand) error {
+	for _, other := range listBrands() {
+		if other.ID == b.ID {
+			continue
+		}
+		for _, h := range other.HostList() {
+			for _, mine := range b.HostList() {
+				if h == mine {
+					return fmt.Errorf("%s is already used by %s", h, other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// saveBrand inserts or updates the brand. Making it the default takes the
+// default away from the others.
+func saveBrand(b *Brand) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if b.IsDefault {
+		if _, err := tx.Exec("UPDATE brands SET is_default = 0 WHERE id != ?", b.ID); err != nil {
+			return err
+		}
+	}
+	if b.ID == 0 {
+		result, err := tx.Exec(`
+            INSERT INTO brands (name, hosts, logo, primary_color, accent_color, success_color,
+                text_color, surface_color, font, footer_text, is_default)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `, b.Name, b.Hosts, b.Logo, b.PrimaryColor, b.AccentColor, b.SuccessColor,
+			b.TextColor, b.SurfaceColor, b.Font, b.FooterText, b.IsDefault)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		b.ID = int(id)
+	} else {
+		_, err := tx.Exec(`
+            UPDATE brands SET name = ?, hosts = ?, logo = ?, primary_color = ?, accent_color = ?, success_color = ?,
+                text_color = ?, surface_color = ?, font = ?, footer_text = ?, is_default = ?
+            WHERE id = ?
+        `, b.Name, b.Hosts, b.Logo, b.PrimaryColor, b.AccentColor, b.SuccessColor,
+			b.TextColor, b.SurfaceColor, b.Font, b.FooterText, b.IsDefault, b.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// processLogo checks an uploaded logo and returns its data and asset key
+func processLogo(r io.Reader) ([]byte, string, string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxLogoSize+1))
+	if err != nil {
+		return nil, "", "", err
+	}
+	if len(data) > maxLogoSize {
+		return nil, "", "", fmt.Errorf("the logo must be smaller than %d MB", maxLogoSize>>20)
+	}
+	kind := http.DetectContentType(data)
+	ext, ok := logoTypes[kind]
+	if !ok {
+		return nil, "", "", errors.New("the logo must be a PNG, JPEG, GIF or WebP image")
+	}
+	sum := sha256.Sum256(data)
+	return data, "brands/logo_" + hex.EncodeToString(sum[:6]) + ext, kind, nil
+}
+
+// adminBrandsHandler lists the brands and creates, edits and deletes them
+func adminBrandsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+
+	if r.Method != http.MethodPost {
+		form := defaultBrand
+		form.IsDefault = false
+		if id, err := strconv.Atoi(r.URL.Query().Get("edit")); err == nil {
+			form = brandByID(id)
+		}
+		renderAdminBrands(w, r, form, nil)
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxLogoSize + 1<<20); err != nil && err != http.ErrNotMultipart {
+		httpError(w, r, http.StatusBadRequest, "Error parsing form")
+		return
+	}
+	id, _ := strconv.Atoi(r.FormValue("id"))
+
+	var before *Brand
+	for _, b := range listBrands() {
+		if b.ID == id {
+			copied := b
+			before = &copied
+		}
+	}
+	if id != 0 && before == nil {
+		httpError(w, r, http.StatusNotFound, "Brand not found")
+		return
+	}
+
+	if r.FormValue("action") == "delete" {
+		if before.IsDefault {
+			renderAdminBrands(w, r, *before, errors.New("the default brand can't be deleted; make another brand the default first"))
+			return
+		}
+		if _, err := db.Exec("DELETE FROM brands WHERE id = ?", id); err != nil {
+			serverError(w, r, fmt.Errorf("deleting brand %d: %w", id, err))
+			return
+		}
+		recordAudit(r, user, "brand.delete", "brand", id, before, nil)
+		loadBrands()
+		http.Redirect(w, r, "/admin/brands", http.StatusSeeOther)
+		return
+	}
+
+	brand := &Brand{
+		ID:           id,
+		Name:         r.FormValue("name"),
+		Hosts:        r.FormValue("hosts"),
+		PrimaryColor: r.FormValue("primary_color"),
+		AccentColor:  r.FormValue("accent_color"),
+		SuccessColor: r.FormValue("success_color"),
+		TextColor:    r.FormValue("text_color"),
+		SurfaceColor: r.FormValue("surface_color"),
+		Font:         r.FormValue("font"),
+		FooterText:   r.FormValue("footer_text"),
+		IsDefault:    r.FormValue("is_default") == "1",
+	}
+	if before != nil {
+		brand.Logo = before.Logo
+		// There must always be a default brand to fall back on
+		if before.IsDefault {
+			brand.IsDefault = true
+		}
+	}
+	if err := normalizeBrand(brand); err != nil {
+		renderAdminBrands(w, r, *brand, err)
+		return
+	}
+	if err := checkBrandHosts(*brand); err != nil {
+		renderAdminBrands(w, r, *brand, err)
+		return
+	}
+
+	file, _, err := r.FormFile("logo")
+	if err == nil {
+		defer file.Close()
+		data, key, kind, err := processLogo(file)
+		if err != nil {
+			renderAdminBrands(w, r, *brand, err)
+			return
+		}
+		if err := assets.Put(r.Context(), key, kind, data); err != nil {
+			serverError(w, r, fmt.Errorf("saving logo: %w", err))
+			return
+		}
+		brand.Logo = key
+	} else if err != http.ErrMissingFile {
+		httpError(w, r, http.StatusBadRequest, "Error reading image")
+		return
+	} else if r.FormValue("remove_logo") == "1" {
+		brand.Logo = ""
+	}
+
+	if err := saveBrand(brand); err != nil {
+		serverError(w, r, fmt.Errorf("saving brand: %w", err))
+		return
+	}
+	if before != nil {
+		recordAudit(r, user, "brand.update", "brand", brand.ID, before, brand)
+	} else {
+		recordAudit(r, user, "brand.create", "brand", brand.ID, nil, brand)
+	}
+	loadBrands()
+	http.Redirect(w, r, "/admin/brands", http.StatusSeeOther)
+}
+
+// renderAdminBrands shows the brand list with the form for one brand
+func renderAdminBrands(w http.ResponseWriter, r *http.Request, form Brand, formErr error) {
+	user, _ := getUserFromSession(r)
+
+	data := struct {
+		User      User
+		Brands    []Brand
+		Form      Brand
+		Error     string
+		MaxLogoKB int
+	}{
+		User:      user,
+		Brands:    listBrands(),
+		Form:      form,
+		MaxLogoKB: maxLogoSize >> 10,
+	}
+	if formErr != nil {
+		msg := formErr.Error()
+		data.Error = strings.ToUpper(msg[:1]) + msg[1:]
+	}
+
+	if err := templates.Render(w, r, "admin_brands", data); err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runCommand runs a command-line subcommand when one is given. It reports
+// false when the server should start normally.
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch args[0] {
+	case "admin":
+		return true, adminCommand(args[1:], os.Stdin)
+	case "import":
+		return true, importCommand(args[1:], os.Stdin, os.Stdout)
+	case "serve":
+		return false, nil
+	default:
+		return true, fmt.Errorf("unknown command %q (available: serve, admin, import)", args[0])
+	}
+}
+
+// adminCommand creates an admin account or resets an existing one
+func adminCommand(args []string, stdin io.Reader) error {
+	fs := flag.NewFlagSet("admin", flag.ContinueOnError)
+	email := fs.String("email", "", "email address of the admin account")
+	name := fs.String("name", "", "display name (required for new accounts)")
+	password := fs.String("password", "", "new password (visible in process lists, prefer -password-stdin)")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from the first line of standard input")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: moobee admin -email EMAIL [-name NAME] (-password PASSWORD | -password-stdin)")
+		fmt.Fprintln(fs.Output(), "Creates an admin account, or grants admin rights to an existing account and resets its password and two-factor sign-in.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pw := *password
+	if *passwordStdin {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		pw = strings.TrimRight(line, "\r\n")
+	}
+	if pw == "" {
+		pw = os.Getenv("MOOBEE_ADMIN_PASSWORD")
+	}
+
+	// Keep the account as it was for the audit log
+	var before interface{}
+	var existingID int
+	if err := db.QueryRow("SELECT id FROM users WHERE email = ?", strings.TrimSpace(*email)).Scan(&existingID); err == nil {
+		if existing, err := getUser(existingID); err == nil {
+			before = auditUser(existing)
+		}
+	}
+
+	userID, created, err := createOrResetAdmin(strings.TrimSpace(*name), *email, pw)
+	if err != nil {
+		return err
+	}
+
+	action := "user.admin_reset"
+	if created {
+		action = "user.admin_create"
+	}
+	if admin, err := getUser(userID); err == nil {
+		recordAudit(nil, User{}, action, "user", userID, before, auditUser(admin))
+	}
+
+	if created {
+		fmt.Printf("Created admin account %s\n", *email)
+	} else {
+		fmt.Printf("Reset password and two-factor sign-in and granted admin rights for %s\n", *email)
+	}
+	return nil
+}
+
+// importCommand validates a CSV or JSON programme file and imports it unless
+// -dry-run is given. Reading from "-" takes the file from standard input.
+func importCommand(args []string, stdin io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "validate and preview without importing anything")
+	format := fs.String("format", "", "file format, csv or json (default: from the file extension)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: moobee import [-dry-run] [-format csv|json] FILE")
+		fmt.Fprintln(fs.Output(), "Imports movies and showtimes. CSV files need a header row with title, time, runtime, price and optionally image, auditorium and the movie details.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("exactly one file is required")
+	}
+
+	path := fs.Arg(0)
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := importFormat(*format, path)
+	if err != nil {
+		return err
+	}
+	mi, err := parseMovieImport(data, f)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range mi.Rows {
+		status := "new"
+		if len(row.Errors) > 0 {
+			status = "error: " + strings.Join(row.Errors, "; ")
+		} else if row.Duplicate {
+			status = "duplicate, skipped"
+		}
+		fmt.Fprintf(out, "line %d\t%s\t%s\t%s\n", row.Line, row.Movie.Title, row.Movie.ShowtimeLabel(), status)
+	}
+	fmt.Fprintf(out, "%d new, %d duplicate(s), %d error(s)\n", mi.New(), mi.Duplicates, mi.Errors)
+
+	if !mi.Valid() {
+		return errors.New("nothing was imported, fix the errors above and try again")
+	}
+	if *dryRun {
+		return nil
+	}
+
+	added, err := commitMovieImport(mi)
+	if err != nil {
+		return err
+	}
+	recordAudit(nil, User{}, "movie.import", "import", path, nil, mi.summary(added))
+	fmt.Fprintf(out, "Imported %d movie(s)\n", added)
+	return nil
+}
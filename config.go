@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// envOr returns the environment variable key, or fallback when it is unset or empty
+func envOr(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// baseURL is the externally visible address of the site, used to build
+// absolute links such as OAuth redirect URIs
+func baseURL() string {
+	return strings.TrimRight(envOr("MOOBEE_BASE_URL", "http://localhost:8080"), "/")
+}
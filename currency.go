@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Currency is an ISO 4217 currency that movies can be priced in
+type Currency struct {
+	Code   string
+	Symbol string
+	Digits int // decimal places of the minor unit, e.g. 2 for cents
+}
+
+// currencies are the currencies offered in the admin form and accepted by
+// the import and the API
+var currencies = []Currency{
+	{Code: "USD", Symbol: "$", Digits: 2},
+	{Code: "EUR", Symbol: "€", Digits: 2},
+	{Code: "GBP", Symbol: "£", Digits: 2},
+	{Code: "CHF", Symbol: "CHF", Digits: 2},
+	{Code: "CAD", Symbol: "CA$", Digits: 2},
+	{Code: "AUD", Symbol: "A$", Digits: 2},
+	{Code: "NZD", Symbol: "NZ$", Digits: 2},
+	{Code: "SEK", Symbol: "kr", Digits: 2},
+	{Code: "NOK", Symbol: "kr", Digits: 2},
+	{Code: "DKK", Symbol: "kr.", Digits: 2},
+	{Code: "PLN", Symbol: "zł", Digits: 2},
+	{Code: "CZK", Symbol: "Kč", Digits: 2},
+	{Code: "MXN", Symbol: "MX$", Digits: 2},
+	{Code: "BRL", Symbol: "R$", Digits: 2},
+	{Code: "INR", Symbol: "₹", Digits: 2},
+	{Code: "JPY", Symbol: "¥", Digits: 0},
+	{Code: "KRW", Symbol: "₩", Digits: 0},
+	{Code: "KWD", Symbol: "KD", Digits: 3},
+	{Code: "BHD", Symbol: "BD", Digits: 3},
+}
+
+// Amount is a sum of money in one currency
+type Amount struct {
+	Value    Money
+	Currency string
+}
+
+var (
+	siteCurrencyOnce sync.Once
+	siteCurrencyCode string
+)
+
+// findCurrency looks up a currency by its ISO code, in any case
+func findCurrency(code string) (Currency, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for _, c := range currencies {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return Currency{}, false
+}
+
+// currencyFor returns the currency with the code, falling back to the site
+// currency for codes that aren't known
+func currencyFor(code string) Currency {
+	if c, ok := findCurrency(code); ok {
+		return c
+	}
+	c, _ := findCurrency(siteCurrency())
+	return c
+}
+
+// siteCurrency is the cinema's own currency, set with MOOBEE_CURRENCY. New
+// movies are priced in it unless another currency is chosen, and box-office
+// cash drawers are counted in it.
+func siteCurrency() string {
+	siteCurrencyOnce.Do(func() {
+		siteCurrencyCode = "USD"
+		if code := envOr("MOOBEE_CURRENCY", ""); code != "" {
+			c, ok := findCurrency(code)
+			if !ok {
+				log.Printf("Unknown MOOBEE_CURRENCY %q, using USD", code)
+				return
+			}
+			siteCurrencyCode = c.Code
+		}
+	})
+	return siteCurrencyCode
+}
+
+// normalizeCurrency upper-cases the movie's currency, defaulting to the site
+// currency, and checks that it is supported
+func normalizeCurrency(m *Movie) error {
+	if strings.TrimSpace(m.Currency) == "" {
+		m.Currency = siteCurrency()
+		return nil
+	}
+	c, ok := findCurrency(m.Currency)
+	if !ok {
+		return fmt.Errorf("currency must be an ISO 4217 code such as USD or EUR")
+	}
+	m.Currency = c.Code
+	return nil
+}
+
+// revenueByCurrency totals confirmed bookings in each currency they were
+// charged in. The site currency is always included.
+func revenueByCurrency() ([]Amount, error) {
+	rows, err := db.Query(`
+        SELECT currency, SUM(total_minor) FROM bookings
+        WHERE status = ?
+        GROUP BY currency
+        ORDER BY currency = ? DESC, currency
+    `, bookingConfirmed, siteCurrency())
+	if err != nil {
+		return []Amount{{Currency: siteCurrency()}}, err
+	}
+	defer rows.Close()
+
+	var totals []Amount
+	for rows.Next() {
+		var a Amount
+		if err := rows.Scan(&a.Currency, &a.Value); err != nil {
+			return totals, err
+		}
+		totals = append(totals, a)
+	}
+	if len(totals) == 0 || totals[0].Currency != siteCurrency() {
+		totals = append([]Amount{{Currency: siteCurrency()}}, totals...)
+	}
+	return totals, rows.Err()
+}
@@ -3,12 +3,9 @@ package main
 import (
 	"database/sql"
 	"fmt"
-	"log"
 	"os"
-	"path/filepath"
 
 	_ "github.com/mattn/go-sqlite3"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var db *sql.DB
@@ -36,10 +33,8 @@ func InitDB() error {
 		return err
 	}
 
-	// Create default admin user
-	if err = ensureAdminUser(); err != nil {
-		log.Printf("Warning: Failed to create admin user: %v", err)
-	}
+	// Index movies for search, if this SQLite has FTS5
+	setupSearchIndex()
 
 	return nil
 }
@@ -51,10 +46,10 @@ func createTables() error {
 		CREATE TABLE IF NOT EXISTS movies (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			title TEXT NOT NULL,
-			time TEXT NOT NULL,
-			duration TEXT NOT NULL,
+			starts_at TIMESTAMP NOT NULL,
+			runtime INTEGER NOT NULL,
 			image TEXT,
-			price REAL NOT NULL
+			price_minor INTEGER NOT NULL
         )
     `)
 	if err != nil {
@@ -99,7 +94,7 @@ func createTables() error {
             movie_id INTEGER NOT NULL,
             name TEXT NOT NULL,
             email TEXT NOT NULL,
-            total REAL NOT NULL,
+            total_minor INTEGER NOT NULL,
             date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
             FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL,
             FOREIGN KEY (movie_id) REFERENCES movies (id) ON DELETE CASCADE
@@ -133,52 +128,311 @@ func createTables() error {
             FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
         )
     `)
+	if err != nil {
+		return err
+	}
 
-	return err
-}
+	// Create recovery_codes table for two-factor authentication
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS recovery_codes (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id INTEGER NOT NULL,
+            code_hash TEXT NOT NULL,
+            used_at TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+        )
+    `)
+	if err != nil {
+		return err
+	}
+
+	// Create user_identities table linking accounts to OIDC providers
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS user_identities (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id INTEGER NOT NULL,
+            provider TEXT NOT NULL,
+            subject TEXT NOT NULL,
+            email TEXT NOT NULL,
+            date_linked TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (provider, subject),
+            FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+        )
+    `)
+	if err != nil {
+		return err
+	}
+
+	// Create oidc_logins table holding in-flight SSO logins
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS oidc_logins (
+            state TEXT PRIMARY KEY,
+            provider TEXT NOT NULL,
+            nonce TEXT NOT NULL,
+            verifier TEXT NOT NULL,
+            expires_at TIMESTAMP NOT NULL
+        )
+    `)
+	if err != nil {
+		return err
+	}
+
+	// Create api_tokens table for personal access tokens
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS api_tokens (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            token_hash TEXT UNIQUE NOT NULL,
+            scopes TEXT NOT NULL,
+            date_created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            last_used_at TIMESTAMP,
+            revoked_at TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+        )
+    `)
+	if err != nil {
+		return err
+	}
 
-// ensureAdminUser makes sure there's at least one admin user in the system
-func ensureAdminUser() error {
-	// Check if admin exists
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin = 1").Scan(&count)
+	// Create settings table for admin-editable policies
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS settings (
+            key TEXT PRIMARY KEY,
+            value TEXT NOT NULL
+        )
+    `)
+	if err != nil {
+		return err
+	}
+
+	// Create seat_blocks table for seats taken out of sale or held for house use.
+	// Rows without a movie_id apply to every screening in the auditorium.
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS seat_blocks (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            movie_id INTEGER,
+            auditorium TEXT NOT NULL,
+            row INTEGER NOT NULL,
+            col INTEGER NOT NULL,
+            kind TEXT NOT NULL,
+            note TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (movie_id) REFERENCES movies (id) ON DELETE CASCADE
+        )
+    `)
 	if err != nil {
 		return err
 	}
 
-	// If no admin, create one
-	if count == 0 {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
-		if err != nil {
-			return err
+	// Create pos_shifts table for box-office cash drawer sessions
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS pos_shifts (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id INTEGER NOT NULL,
+            opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            closed_at TIMESTAMP,
+            opening_float_minor INTEGER NOT NULL DEFAULT 0,
+            counted_cash_minor INTEGER,
+            note TEXT NOT NULL DEFAULT '',
+            FOREIGN KEY (user_id) REFERENCES users (id)
+        )
+    `)
+	if err != nil {
+		return err
+	}
+
+	// Create the append-only audit log of admin and privileged actions
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS audit_log (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            user_id INTEGER,
+            user_email TEXT NOT NULL DEFAULT '',
+            action TEXT NOT NULL,
+            target_type TEXT NOT NULL DEFAULT '',
+            target_id TEXT NOT NULL DEFAULT '',
+            before TEXT NOT NULL DEFAULT '',
+            after TEXT NOT NULL DEFAULT '',
+            ip TEXT NOT NULL DEFAULT ''
+        );
+        CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+        CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+        BEGIN
+            SELECT RAISE(ABORT, 'audit log is append-only');
+        END;
+        CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+        BEGIN
+            SELECT RAISE(ABORT, 'audit log is append-only');
+        END;
+    `)
+	if err != nil {
+		return err
+	}
+
+	// Create brands table for the look of each cinema brand served by the site
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS brands (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            hosts TEXT NOT NULL DEFAULT '',
+            logo TEXT NOT NULL DEFAULT '',
+            primary_color TEXT NOT NULL,
+            accent_color TEXT NOT NULL,
+            success_color TEXT NOT NULL,
+            text_color TEXT NOT NULL,
+            surface_color TEXT NOT NULL,
+            font TEXT NOT NULL,
+            footer_text TEXT NOT NULL DEFAULT '',
+            is_default INTEGER NOT NULL DEFAULT 0
+        )
+    `)
+	if err != nil {
+		return err
+	}
+	if err := seedDefaultBrand(); err != nil {
+		return err
+	}
+
+	return migrateTables()
+}
+
+// migrateTables adds columns introduced after the original schema to
+// databases created by older versions
+func migrateTables() error {
+	migrations := []struct {
+		table, column, definition string
+	}{
+		{"users", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "totp_enabled", "INTEGER NOT NULL DEFAULT 0"},
+		{"sessions", "mfa_pending", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "disabled", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookings", "status", "TEXT NOT NULL DEFAULT 'confirmed'"},
+		{"bookings", "cancelled_at", "TIMESTAMP"},
+		{"movies", "auditorium", "TEXT NOT NULL DEFAULT 'Screen 1'"},
+		{"users", "is_staff", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookings", "payment_method", "TEXT NOT NULL DEFAULT 'online'"},
+		{"bookings", "sold_by", "INTEGER"},
+		{"bookings", "shift_id", "INTEGER"},
+		{"movies", "genre", "TEXT NOT NULL DEFAULT ''"},
+		{"movies", "age_rating", "TEXT NOT NULL DEFAULT ''"},
+		{"movies", "synopsis", "TEXT NOT NULL DEFAULT ''"},
+		{"movies", "cast_members", "TEXT NOT NULL DEFAULT ''"},
+		{"movies", "director", "TEXT NOT NULL DEFAULT ''"},
+		{"movies", "language", "TEXT NOT NULL DEFAULT ''"},
+		{"movies", "release_date", "TEXT NOT NULL DEFAULT ''"},
+		{"movies", "trailer_url", "TEXT NOT NULL DEFAULT ''"},
+		{"movies", "starts_at", "TIMESTAMP"},
+		{"movies", "runtime", "INTEGER NOT NULL DEFAULT 0"},
+		{"movies", "poster", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "locale", "TEXT NOT NULL DEFAULT ''"},
+		{"movies", "currency", "TEXT NOT NULL DEFAULT ''"},
+		{"bookings", "currency", "TEXT NOT NULL DEFAULT ''"},
+		{"pos_shifts", "currency", "TEXT NOT NULL DEFAULT ''"},
+		{"movies", "price_minor", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookings", "total_minor", "INTEGER NOT NULL DEFAULT 0"},
+		{"pos_shifts", "opening_float_minor", "INTEGER NOT NULL DEFAULT 0"},
+		{"pos_shifts", "counted_cash_minor", "INTEGER"},
+		{"users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+		{"sessions", "mfa_failures", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookings", "refund_minor", "INTEGER NOT NULL DEFAULT 0"},
+		{"bookings", "refund_currency", "TEXT NOT NULL DEFAULT ''"},
+		{"bookings", "refunded_at", "TIMESTAMP"},
+	}
+
+	for _, m := range migrations {
+		if err := addColumnIfMissing(m.table, m.column, m.definition); err != nil {
+			return fmt.Errorf("migrating %s.%s: %w", m.table, m.column, err)
 		}
+	}
 
-		_, err = db.Exec(
-			"INSERT INTO users (name, email, password, is_admin) VALUES (?, ?, ?, ?)",
-			"Admin", "admin@example.com", string(hashedPassword), 1,
-		)
-		if err != nil {
-			return err
+	if err := migrateShowtimes(); err != nil {
+		return fmt.Errorf("migrating showtimes: %w", err)
+	}
+
+	// Prices used to be in the site currency, whatever it was
+	currencyUpdates := []string{
+		"UPDATE movies SET currency = ? WHERE currency = ''",
+		"UPDATE bookings SET currency = COALESCE((SELECT m.currency FROM movies m WHERE m.id = bookings.movie_id), ?) WHERE currency = ''",
+		"UPDATE pos_shifts SET currency = ? WHERE currency = ''",
+	}
+	for _, query := range currencyUpdates {
+		if _, err := db.Exec(query, siteCurrency()); err != nil {
+			return fmt.Errorf("setting currencies: %w", err)
 		}
+	}
+
+	// Amounts used to be stored as REAL, which can't hold most prices exactly
+	if err := migrateMoney(); err != nil {
+		return fmt.Errorf("migrating amounts: %w", err)
+	}
 
-		log.Println("Created admin user: admin@example.com / admin123")
+	// Refunds used to only change the status, always for the whole total
+	_, err := db.Exec(
+		"UPDATE bookings SET refund_minor = total_minor, refund_currency = currency, refunded_at = cancelled_at WHERE status = ? AND refund_currency = ''",
+		bookingRefunded,
+	)
+	if err != nil {
+		return fmt.Errorf("recording refunds: %w", err)
+	}
+
+	// Movies without an upload used to point at an image that never existed.
+	// Clearing it shows the generated placeholder instead.
+	if _, err := db.Exec("UPDATE movies SET image = '' WHERE image = ?", legacyDefaultImage); err != nil {
+		return fmt.Errorf("clearing default images: %w", err)
 	}
 
 	return nil
 }
 
-// CreateImagesDirectory creates the directory for storing movie images
-func CreateImagesDirectory() error {
-	imagesDir := filepath.Join("static", "images")
-	return os.MkdirAll(imagesDir, 0755)
+// addColumnIfMissing adds a column to an existing table unless it is already present
+func addColumnIfMissing(table, column, definition string) error {
+	exists, err := columnExists(table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// columnExists reports whether the table has the column
+func columnExists(table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
-// GetImagePath returns the local path for a movie image
-func GetImagePath(movieID int) string {
-	return filepath.Join("static", "images", fmt.Sprintf("movie_%d.jpg", movieID))
+// getSetting returns the stored value for key, or fallback if it has not been set
+func getSetting(key, fallback string) string {
+	var value string
+	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err != nil {
+		return fallback
+	}
+	return value
 }
 
-// GetImageURL returns the URL for a movie image
-func GetImageURL(movieID int) string {
-	return fmt.Sprintf("/static/images/movie_%d.jpg", movieID)
+// setSetting stores value under key, replacing any previous value
+func setSetting(key, value string) error {
+	_, err := db.Exec(
+		"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value",
+		key, value,
+	)
+	return err
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// internalErrorMessage is all customers see of an unexpected error. The
+// details are logged under the error ID shown alongside it.
+const internalErrorMessage = "Something went wrong on our side. Please try again in a moment."
+
+// newErrorID returns a short random ID that ties an error response to its
+// log entry
+func newErrorID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// wantsJSON reports whether the error response should be JSON: requests to
+// the API and scripts that only accept JSON
+func wantsJSON(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// httpError responds with the status and a message that is safe to show:
+// the error page for browsers, or the API's JSON error format
+func httpError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeError(w, r, status, message, "")
+}
+
+// notFound responds with the not-found error page
+func notFound(w http.ResponseWriter, r *http.Request) {
+	httpError(w, r, http.StatusNotFound, "Page not found")
+}
+
+// serverError logs err with a new error ID and responds with a 500 that
+// shows only the ID, so template and database errors don't reach customers
+func serverError(w http.ResponseWriter, r *http.Request, err error) {
+	id := newErrorID()
+	log.Printf("Error %s on %s %s: %v", id, r.Method, r.URL.Path, err)
+	writeError(w, r, http.StatusInternalServerError, internalErrorMessage, id)
+}
+
+// writeError sends the error as JSON or as the error page, with the error ID
+// when there is one
+func writeError(w http.ResponseWriter, r *http.Request, status int, message, errorID string) {
+	if wantsJSON(r) {
+		body := map[string]string{"error": message}
+		if errorID != "" {
+			body["errorId"] = errorID
+		}
+		writeJSON(w, status, body)
+		return
+	}
+
+	user, _ := getUserFromSession(r)
+	data := struct {
+		User    User
+		Status  int
+		Title   string
+		Message string
+		ErrorID string
+	}{
+		User:    user,
+		Status:  status,
+		Title:   http.StatusText(status),
+		Message: message,
+		ErrorID: errorID,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	var page bytes.Buffer
+	if templates == nil || templates.Render(&page, r, "error", data) != nil {
+		// The error page itself is broken, so fall back to plain text
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write([]byte(requestLocale(r).T(message)))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	page.WriteTo(w)
+}
+
+// recoverMiddleware turns a panicking handler into a logged 500 instead of
+// a dropped connection
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			id := newErrorID()
+			log.Printf("Error %s on %s %s: panic: %v\n%s", id, r.Method, r.URL.Path, p, debug.Stack())
+			writeError(w, r, http.StatusInternalServerError, internalErrorMessage, id)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
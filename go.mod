@@ -1,10 +1,16 @@
 module movie_tickets
 
-go 1.23.0 // Changed from invalid version 1.23.0
+go 1.23.0
 
 toolchain go1.23.5
 
 require (
+	github.com/coreos/go-oidc/v3 v3.11.0
 	github.com/mattn/go-sqlite3 v1.14.27
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	golang.org/x/crypto v0.37.0
+	golang.org/x/image v0.25.0
+	golang.org/x/oauth2 v0.27.0
 )
+
+require github.com/go-jose/go-jose/v4 v4.0.2 // indirect
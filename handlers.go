@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -14,34 +17,84 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Error string
-	}{}
+		Error     string
+		Providers []*OIDCProvider
+	}{
+		Providers: loginProviders(),
+	}
 
 	if r.Method == http.MethodPost {
 		email := r.FormValue("email")
 		password := r.FormValue("password")
 
-		token, _, err := loginUser(email, password)
+		token, _, mfaPending, err := loginUser(email, password)
 		if err != nil {
 			data.Error = err.Error()
+		} else if mfaPending {
+			// Password was correct, now ask for the second factor
+			setSessionCookie(w, token, mfaPendingDuration)
+			http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+			return
 		} else {
 			// Set session cookie
-			http.SetCookie(w, &http.Cookie{
-				Name:     "session",
-				Value:    token,
-				Path:     "/",
-				Expires:  time.Now().Add(24 * time.Hour),
-				HttpOnly: true,
-			})
+			setSessionCookie(w, token, sessionDuration)
+
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	}
+
+	err := templates.Render(w, r, "login", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// loginMFAHandler is the second login step for accounts with 2FA enabled
+func loginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user, pendingToken, err := getPendingMFAUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Error  string
+		Email  string
+		Locked bool
+	}{
+		Email: user.Email,
+	}
 
+	if r.Method == http.MethodPost {
+		if verifySecondFactor(user.ID, r.FormValue("code")) {
+			token, err := completeMFALogin(pendingToken, user.ID)
+			if err != nil {
+				serverError(w, r, fmt.Errorf("creating session: %w", err))
+				return
+			}
+
+			setSessionCookie(w, token, sessionDuration)
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
+		data.Error = "Invalid authentication or recovery code"
+
+		locked, err := recordMFAFailure(pendingToken)
+		if err != nil {
+			serverError(w, r, fmt.Errorf("counting failed 2FA attempts: %w", err))
+			return
+		}
+		if locked {
+			setSessionCookie(w, "", -time.Hour)
+			data.Error = "Too many wrong codes. Please sign in again."
+			data.Locked = true
+		}
 	}
 
-	err := templates.ExecuteTemplate(w, "login", data)
+	err = templates.Render(w, r, "login_2fa", data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
@@ -85,18 +138,12 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 				data.Error = err.Error()
 			} else {
 				// Automatically log in the user
-				token, _, err := loginUser(email, password)
+				token, _, _, err := loginUser(email, password)
 				if err != nil {
 					data.Error = "Registration successful, but could not log in: " + err.Error()
 				} else {
 					// Set session cookie
-					http.SetCookie(w, &http.Cookie{
-						Name:     "session",
-						Value:    token,
-						Path:     "/",
-						Expires:  time.Now().Add(24 * time.Hour),
-						HttpOnly: true,
-					})
+					setSessionCookie(w, token, sessionDuration)
 
 					http.Redirect(w, r, "/", http.StatusSeeOther)
 					return
@@ -105,12 +152,30 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err := templates.ExecuteTemplate(w, "register", data)
+	err := templates.Render(w, r, "register", data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
+// ProfileView carries the result of the last profile action to the page
+type ProfileView struct {
+	TwoFactor  TwoFactorView
+	NewToken   string
+	TokenError string
+}
+
+// TwoFactorView carries the 2FA section state rendered on the profile page
+type TwoFactorView struct {
+	Required          bool
+	QRCode            template.URL
+	Secret            string
+	RecoveryCodes     []string
+	RecoveryRemaining int
+	Error             string
+	Message           string
+}
+
 func profileHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := getUserFromSession(r)
 	if err != nil {
@@ -118,9 +183,166 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Admins are sent here when the 2FA policy needs them to enroll first
+	var view ProfileView
+	view.TwoFactor.Required = r.URL.Query().Get("require2fa") == "1"
+	renderProfile(w, r, user, view)
+}
+
+// profileTwoFactorHandler handles 2FA enrollment, recovery codes and removal
+func profileTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	var view TwoFactorView
+	switch r.FormValue("action") {
+	case "setup":
+		secret, err := startTOTPEnrollment(user.ID)
+		if err == errTOTPAlreadyEnabled {
+			view.Error = "Two-factor authentication is already enabled"
+			break
+		} else if err != nil {
+			view.Error = "Could not start two-factor setup"
+			break
+		}
+		qr, err := totpQRCode(user.Email, secret)
+		if err != nil {
+			log.Printf("Error rendering QR code: %v", err)
+		}
+		recordAudit(r, user, "user.2fa_setup", "user", user.ID, nil, nil)
+		view.QRCode = qr
+		view.Secret = secret
+		user.TOTPEnabled = false
+
+	case "enable":
+		codes, err := enableTOTP(user.ID, r.FormValue("code"))
+		if err != nil {
+			view.Error = err.Error()
+			break
+		}
+		recordAudit(r, user, "user.2fa_enable", "user", user.ID,
+			map[string]bool{"two_factor": false}, map[string]bool{"two_factor": true})
+		view.RecoveryCodes = codes
+		view.Message = "Two-factor authentication is now enabled"
+		user.TOTPEnabled = true
+
+	case "recovery":
+		if !user.TOTPEnabled || !verifySecondFactor(user.ID, r.FormValue("code")) {
+			view.Error = "Invalid authentication code"
+			break
+		}
+		codes, err := regenerateRecoveryCodes(user.ID)
+		if err != nil {
+			view.Error = "Could not generate recovery codes"
+			break
+		}
+		recordAudit(r, user, "user.2fa_recovery", "user", user.ID, nil, nil)
+		view.RecoveryCodes = codes
+		view.Message = "New recovery codes generated"
+
+	case "disable":
+		if user.IsAdmin && adminRequires2FA() {
+			view.Error = "Two-factor authentication is required for admin accounts"
+			break
+		}
+		if !user.TOTPEnabled || !verifySecondFactor(user.ID, r.FormValue("code")) {
+			view.Error = "Invalid authentication code"
+			break
+		}
+		if err := disableTOTP(user.ID); err != nil {
+			view.Error = "Could not disable two-factor authentication"
+			break
+		}
+		recordAudit(r, user, "user.2fa_disable", "user", user.ID,
+			map[string]bool{"two_factor": true}, map[string]bool{"two_factor": false})
+		view.Message = "Two-factor authentication has been disabled"
+		user.TOTPEnabled = false
+
+	default:
+		httpError(w, r, http.StatusBadRequest, "Unknown action")
+		return
+	}
+
+	renderProfile(w, r, user, ProfileView{TwoFactor: view})
+}
+
+// profileTokensHandler creates and revokes personal API tokens
+func profileTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		httpError(w, r, http.StatusBadRequest, "Error parsing form")
+		return
+	}
+
+	var view ProfileView
+	switch r.FormValue("action") {
+	case "create":
+		token, created, err := createAPIToken(user, r.FormValue("name"), r.Form["scopes"])
+		if err != nil {
+			view.TokenError = err.Error()
+			break
+		}
+		recordAudit(r, user, "token.create", "token", created.ID, nil, map[string]interface{}{
+			"owner":  created.UserEmail,
+			"name":   created.Name,
+			"scopes": created.Scopes,
+		})
+		view.NewToken = token
+
+	case "revoke":
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		token, err := revokeAPIToken(user, id)
+		if err != nil {
+			view.TokenError = err.Error()
+			break
+		}
+		// Admins revoking someone else's token is a privileged action
+		if token.UserID != user.ID {
+			recordAudit(r, user, "token.revoke", "token", token.ID, map[string]interface{}{
+				"owner":  token.UserEmail,
+				"name":   token.Name,
+				"scopes": token.Scopes,
+			}, nil)
+		}
+
+	default:
+		httpError(w, r, http.StatusBadRequest, "Unknown action")
+		return
+	}
+
+	renderProfile(w, r, user, view)
+}
+
+func renderProfile(w http.ResponseWriter, r *http.Request, user User, view ProfileView) {
+	twoFactor := view.TwoFactor
+	if user.IsAdmin && adminRequires2FA() {
+		twoFactor.Required = true
+	}
+	if user.TOTPEnabled {
+		twoFactor.RecoveryRemaining = remainingRecoveryCodes(user.ID)
+	}
+
 	// Get user's bookings
 	rows, err := db.Query(`
-        SELECT id, name, email, movie_id, total, date
+        SELECT id, name, email, movie_id, total_minor, currency, date, status
         FROM bookings 
         WHERE user_id = ? OR email = ?
         ORDER BY date DESC
@@ -128,7 +350,7 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
     `, user.ID, user.Email)
 
 	if err != nil {
-		http.Error(w, "Error loading bookings", http.StatusInternalServerError)
+		serverError(w, r, fmt.Errorf("loading bookings: %w", err))
 		return
 	}
 	defer rows.Close()
@@ -136,7 +358,7 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 	var bookings []Booking
 	for rows.Next() {
 		var b Booking
-		if err := rows.Scan(&b.ID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Date); err != nil {
+		if err := rows.Scan(&b.ID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Currency, &b.Date, &b.Status); err != nil {
 			log.Printf("Error scanning booking row: %v", err)
 			continue
 		}
@@ -146,30 +368,59 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 		bookings = append(bookings, b)
 	}
 
+	tokens, err := listAPITokens(user.ID)
+	if err != nil {
+		log.Printf("Error loading API tokens: %v", err)
+	}
+
+	// Admins can also see and revoke everyone else's tokens
+	var allTokens []APIToken
+	if user.IsAdmin {
+		allTokens, err = listAPITokens(0)
+		if err != nil {
+			log.Printf("Error loading API tokens: %v", err)
+		}
+	}
+
 	data := struct {
-		User     User
-		Bookings []Booking
+		User       User
+		Bookings   []Booking
+		TwoFactor  TwoFactorView
+		Identities []UserIdentity
+		Providers  []*OIDCProvider
+		Tokens     []APIToken
+		AllTokens  []APIToken
+		Scopes     []APIScope
+		NewToken   string
+		TokenError string
 	}{
-		User:     user,
-		Bookings: bookings,
+		User:       user,
+		Bookings:   bookings,
+		TwoFactor:  twoFactor,
+		Identities: getUserIdentities(user.ID),
+		Providers:  loginProviders(),
+		Tokens:     tokens,
+		AllTokens:  allTokens,
+		Scopes:     apiScopes,
+		NewToken:   view.NewToken,
+		TokenError: view.TokenError,
 	}
 
-	err = templates.ExecuteTemplate(w, "profile", data)
+	err = templates.Render(w, r, "profile", data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
 func adminHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := getUserFromSession(r)
 	if err != nil || !user.IsAdmin {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		httpError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Get statistics for admin dashboard
 	var movieCount, bookingCount, userCount int
-	var totalRevenue float64
 
 	// Count movies
 	err = db.QueryRow("SELECT COUNT(*) FROM movies").Scan(&movieCount)
@@ -178,7 +429,7 @@ func adminHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Count bookings
-	err = db.QueryRow("SELECT COUNT(*) FROM bookings").Scan(&bookingCount)
+	err = db.QueryRow("SELECT COUNT(*) FROM bookings WHERE status = ?", bookingConfirmed).Scan(&bookingCount)
 	if err != nil {
 		bookingCount = 0
 	}
@@ -189,21 +440,21 @@ func adminHandler(w http.ResponseWriter, r *http.Request) {
 		userCount = 0
 	}
 
-	// Calculate total revenue
-	err = db.QueryRow("SELECT COALESCE(SUM(total), 0) FROM bookings").Scan(&totalRevenue)
+	// Total revenue, per currency
+	revenue, err := revenueByCurrency()
 	if err != nil {
-		totalRevenue = 0
+		log.Printf("Error totalling revenue: %v", err)
 	}
 
 	// Get recent bookings
 	rows, err := db.Query(`
-        SELECT b.id, b.name, b.email, b.movie_id, b.total, b.date
+        SELECT b.id, b.name, b.email, b.movie_id, b.total_minor, b.currency, b.date, b.status
         FROM bookings b
         ORDER BY b.date DESC 
         LIMIT 10
     `)
 	if err != nil {
-		http.Error(w, "Error loading recent bookings", http.StatusInternalServerError)
+		serverError(w, r, fmt.Errorf("loading recent bookings: %w", err))
 		return
 	}
 	defer rows.Close()
@@ -211,7 +462,7 @@ func adminHandler(w http.ResponseWriter, r *http.Request) {
 	var recentBookings []Booking
 	for rows.Next() {
 		var b Booking
-		if err := rows.Scan(&b.ID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Date); err != nil {
+		if err := rows.Scan(&b.ID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Currency, &b.Date, &b.Status); err != nil {
 			log.Printf("Error scanning booking row: %v", err)
 			continue
 		}
@@ -222,38 +473,81 @@ func adminHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		MovieCount     int
-		BookingCount   int
-		UserCount      int
-		TotalRevenue   float64
-		RecentBookings []Booking
-		User           User
+		MovieCount      int
+		BookingCount    int
+		UserCount       int
+		Revenue         []Amount
+		RecentBookings  []Booking
+		User            User
+		RequireAdmin2FA bool
 	}{
-		MovieCount:     movieCount,
-		BookingCount:   bookingCount,
-		UserCount:      userCount,
-		TotalRevenue:   totalRevenue,
-		RecentBookings: recentBookings,
-		User:           user,
+		MovieCount:      movieCount,
+		BookingCount:    bookingCount,
+		UserCount:       userCount,
+		Revenue:         revenue,
+		RecentBookings:  recentBookings,
+		User:            user,
+		RequireAdmin2FA: adminRequires2FA(),
 	}
 
-	err = templates.ExecuteTemplate(w, "admin", data)
+	err = templates.Render(w, r, "admin", data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
+// adminSecurityHandler updates the admin 2FA policy
+func adminSecurityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	user, err := getUserFromSession(r)
+	if err != nil {
+		httpError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	require := r.FormValue("require_admin_2fa") == "1"
+
+	// Don't let an admin lock themselves out of the admin pages
+	if require && !user.TOTPEnabled {
+		http.Redirect(w, r, "/profile?require2fa=1", http.StatusSeeOther)
+		return
+	}
+
+	value := "0"
+	if require {
+		value = "1"
+	}
+	previous := getSetting(settingRequireAdmin2FA, "0")
+	if err := setSetting(settingRequireAdmin2FA, value); err != nil {
+		serverError(w, r, fmt.Errorf("saving setting: %w", err))
+		return
+	}
+	recordAudit(r, user, "setting.update", "setting", settingRequireAdmin2FA, previous, value)
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
 // Landing page handler
 func landingHandler(w http.ResponseWriter, r *http.Request) {
+	// "/" also catches every path without a handler of its own
+	if r.URL.Path != "/" {
+		notFound(w, r)
+		return
+	}
+
 	// If user is already logged in, redirect to home
 	if isAuthenticated(r) {
 		http.Redirect(w, r, "/home", http.StatusSeeOther)
 		return
 	}
 
-	err := templates.ExecuteTemplate(w, "landing", nil)
+	err := templates.Render(w, r, "landing", nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
@@ -261,7 +555,7 @@ func landingHandler(w http.ResponseWriter, r *http.Request) {
 func homeHandler(w http.ResponseWriter, r *http.Request) {
 	// If the request is for the root path only
 	if r.URL.Path != "/" && r.URL.Path != "/home" {
-		http.NotFound(w, r)
+		notFound(w, r)
 		return
 	}
 
@@ -278,9 +572,8 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Execute template
-	err = templates.ExecuteTemplate(w, "home", data)
+	err = templates.Render(w, r, "home", data)
 	if err != nil {
-		log.Printf("Error executing template: %v", err)
-		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		serverError(w, r, fmt.Errorf("rendering page: %w", err))
 	}
 }
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localeFiles holds a message catalog per language, mapping the English text
+// used in the templates to its translation. English needs no catalog.
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Locale is a supported language with its translations and the conventions
+// for showing numbers, prices and dates. Date layouts are Go layouts where
+// {weekday} and {month} stand for the abbreviated names.
+type Locale struct {
+	Tag  string // BCP 47 language tag
+	Name string // the language's name in itself
+
+	Decimal string
+	Group   string
+	// PricePattern places the currency symbol around the amount
+	PricePattern string
+
+	DateLayout     string
+	DateTimeLayout string
+	ShowtimeLayout string
+	TimeLayout     string
+	Weekdays       [7]string // from Sunday
+	Months         [12]string
+
+	messages map[string]string
+}
+
+// defaultLocale is used when nothing better matches the request
+var defaultLocale = &Locale{
+	Tag:            "en",
+	Name:           "English",
+	Decimal:        ".",
+	Group:          ",",
+	PricePattern:   "{symbol}{amount}",
+	DateLayout:     "{month} 2, 2006",
+	DateTimeLayout: "{month} 2, 2006, 3:04 PM",
+	ShowtimeLayout: "{weekday}, {month} 2 2006 · 3:04 PM",
+	TimeLayout:     "3:04 PM",
+	Weekdays:       [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	Months:         [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+}
+
+// locales are the languages the site is offered in
+var locales = []*Locale{
+	defaultLocale,
+	{
+		Tag:            "de",
+		Name:           "Deutsch",
+		Decimal:        ",",
+		Group:          ".",
+		PricePattern:   "{amount} {symbol}",
+		DateLayout:     "2. {month} 2006",
+		DateTimeLayout: "2. {month} 2006, 15:04",
+		ShowtimeLayout: "{weekday}, 2. {month} 2006 · 15:04",
+		TimeLayout:     "15:04",
+		Weekdays:       [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+		Months:         [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+	},
+	{
+		Tag:            "fr",
+		Name:           "Français",
+		Decimal:        ",",
+		Group:          " ",
+		PricePattern:   "{amount} {symbol}",
+		DateLayout:     "2 {month} 2006",
+		DateTimeLayout: "2 {month} 2006, 15:04",
+		ShowtimeLayout: "{weekday} 2 {month} 2006 · 15:04",
+		TimeLayout:     "15:04",
+		Weekdays:       [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		Months:         [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+	},
+}
+
+// loadCatalogs reads the message catalog of every locale but English
+func loadCatalogs() error {
+	for _, loc := range locales {
+		if loc == defaultLocale {
+			continue
+		}
+		data, err := localeFiles.ReadFile("locales/" + loc.Tag + ".json")
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &loc.messages); err != nil {
+			return fmt.Errorf("locales/%s.json: %w", loc.Tag, err)
+		}
+	}
+	return nil
+}
+
+// findLocale returns the supported locale for a tag such as "de" or "de-AT",
+// or nil when there is none
+func findLocale(tag string) *Locale {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	for _, loc := range locales {
+		if loc.Tag == tag {
+			return loc
+		}
+	}
+	return nil
+}
+
+// acceptLanguage picks the supported locale the browser prefers most from an
+// Accept-Language header such as "de-DE,de;q=0.9,en;q=0.8"
+func acceptLanguage(header string) *Locale {
+	type choice struct {
+		tag string
+		q   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if tag != "" && q > 0 {
+			choices = append(choices, choice{tag, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+
+	for _, c := range choices {
+		if loc := findLocale(c.tag); loc != nil {
+			return loc
+		}
+	}
+	return defaultLocale
+}
+
+// requestLocale is the language to answer the request in: the one chosen on
+// the user's profile, or else the browser's preference
+func requestLocale(r *http.Request) *Locale {
+	if user, err := getUserFromSession(r); err == nil {
+		if loc := findLocale(user.Locale); loc != nil {
+			return loc
+		}
+	}
+	return acceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// T translates the English message, formatting any arguments into it.
+// Messages missing from the catalog are shown in English.
+func (l *Locale) T(message string, args ...interface{}) string {
+	if translated, ok := l.messages[message]; ok && translated != "" {
+		message = translated
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// FormatNumber shows the number with the locale's separators and the given
+// number of decimals
+func (l *Locale) FormatNumber(n float64, decimals int) string {
+	s := strconv.FormatFloat(n, 'f', decimals, 64)
+	if strings.Trim(s, "-0.") == "" {
+		s = strings.TrimPrefix(s, "-")
+	}
+	return l.formatDecimal(s)
+}
+
+// formatDecimal swaps the separators of a plain decimal such as "-1234.50"
+// for the locale's own
+func (l *Locale) formatDecimal(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(digit)
+	}
+	if frac != "" {
+		b.WriteString(l.Decimal + frac)
+	}
+	return b.String()
+}
+
+// FormatPrice shows an amount in the currency the way the locale writes
+// prices, with as many decimals as the currency has
+func (l *Locale) FormatPrice(amount Money, currency string) string {
+	c := currencyFor(currency)
+	magnitude := amount
+	if amount < 0 {
+		magnitude = -amount
+	}
+	formatted := l.formatDecimal(magnitude.Decimal(c.Code))
+	price := strings.NewReplacer("{symbol}", c.Symbol, "{amount}", formatted).Replace(l.PricePattern)
+	if amount < 0 {
+		price = "-" + price
+	}
+	return price
+}
+
+// formatTime formats t with a locale layout, filling in the weekday and
+// month names
+func (l *Locale) formatTime(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strings.NewReplacer(
+		"{weekday}", l.Weekdays[t.Weekday()],
+		"{month}", l.Months[t.Month()-1],
+	).Replace(t.Format(layout))
+}
+
+// FormatDate shows the date, e.g. "Jan 2, 2006"
+func (l *Locale) FormatDate(t time.Time) string {
+	return l.formatTime(t, l.DateLayout)
+}
+
+// FormatDateTime shows the date and time, e.g. "Jan 2, 2006, 3:04 PM"
+func (l *Locale) FormatDateTime(t time.Time) string {
+	return l.formatTime(t, l.DateTimeLayout)
+}
+
+// FormatTime shows the time of day, e.g. "3:04 PM"
+func (l *Locale) FormatTime(t time.Time) string {
+	return l.formatTime(t, l.TimeLayout)
+}
+
+// FormatShowtime shows a showtime with its weekday in the cinema's time zone
+func (l *Locale) FormatShowtime(t time.Time) string {
+	return l.formatTime(t.In(cinemaLocation()), l.ShowtimeLayout)
+}
+
+// setLocaleHandler saves the language chosen on the profile page. An empty
+// choice goes back to following the browser.
+func setLocaleHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	tag := r.FormValue("locale")
+	if tag != "" && findLocale(tag) == nil {
+		httpError(w, r, http.StatusBadRequest, "Unknown language")
+		return
+	}
+	if _, err := db.Exec("UPDATE users SET locale = ? WHERE id = ?", tag, user.ID); err != nil {
+		serverError(w, r, fmt.Errorf("saving language for user %d: %w", user.ID, err))
+		return
+	}
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
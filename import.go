@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxImportSize limits uploaded import files
+const maxImportSize = 2 << 20
+
+// importColumns are the CSV headers (and JSON keys) an import file can use
+var importColumns = []string{
+	"title", "time", "runtime", "price", "currency", "image", "auditorium",
+	"genre", "age_rating", "synopsis", "cast", "director", "language", "release_date", "trailer",
+}
+
+// MovieImportRow is one entry of an import file along with any problems found
+type MovieImportRow struct {
+	Line      int
+	Movie     Movie
+	Errors    []string
+	Duplicate bool
+}
+
+// MovieImport is the parsed and validated content of an import file
+type MovieImport struct {
+	Rows       []MovieImportRow
+	Errors     int
+	Duplicates int
+}
+
+// Valid reports whether the import can be committed
+func (mi MovieImport) Valid() bool {
+	return mi.Errors == 0
+}
+
+// New is the number of movies a commit would add
+func (mi MovieImport) New() int {
+	return len(mi.Rows) - mi.Errors - mi.Duplicates
+}
+
+// importFormat picks csv or json from an explicit format or the filename
+func importFormat(format, filename string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+	switch format {
+	case "csv", "json":
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported import format %q (use csv or json)", format)
+	}
+}
+
+// parseMovieImport reads movies from CSV (with a header row) or a JSON array
+// and validates each one, flagging movies already scheduled at the same time
+func parseMovieImport(data []byte, format string) (MovieImport, error) {
+	var mi MovieImport
+	var records []map[string]string
+	var lines []int
+
+	switch format {
+	case "csv":
+		r := csv.NewReader(bytes.NewReader(data))
+		r.TrimLeadingSpace = true
+		header, err := r.Read()
+		if err == io.EOF {
+			return mi, errors.New("the file is empty")
+		} else if err != nil {
+			return mi, err
+		}
+		for i := range header {
+			header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+			// Files written for older versions call the runtime "duration"
+			if header[i] == "duration" {
+				header[i] = "runtime"
+			}
+		}
+		for _, required := range importColumns[:4] {
+			if !containsString(header, required) {
+				return mi, fmt.Errorf("missing %q column (expected: %s)", required, strings.Join(importColumns, ", "))
+			}
+		}
+
+		for {
+			fields, err := r.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return mi, err
+			}
+			line, _ := r.FieldPos(0)
+			record := make(map[string]string)
+			for i, name := range header {
+				if i < len(fields) {
+					record[name] = strings.TrimSpace(fields[i])
+				}
+			}
+			records = append(records, record)
+			lines = append(lines, line)
+		}
+	case "json":
+		var entries []map[string]interface{}
+		// Numbers are kept as written so prices aren't rounded through float64
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&entries); err != nil {
+			return mi, fmt.Errorf("invalid JSON: %v", err)
+		}
+		for i, entry := range entries {
+			record := make(map[string]string)
+			for k, v := range entry {
+				switch v := v.(type) {
+				case string:
+					record[strings.ToLower(k)] = strings.TrimSpace(v)
+				case json.Number:
+					record[strings.ToLower(k)] = v.String()
+				}
+			}
+			records = append(records, record)
+			lines = append(lines, i+1)
+		}
+	default:
+		return mi, fmt.Errorf("unsupported import format %q", format)
+	}
+
+	if len(records) == 0 {
+		return mi, errors.New("the file contains no movies")
+	}
+
+	seen := make(map[string]bool)
+	buffer := cleaningBuffer()
+	var scheduled []Slot
+	for i, record := range records {
+		row := validateImportRecord(lines[i], record)
+
+		key := strings.ToLower(row.Movie.Title) + "|" + row.Movie.ShowtimeLabel()
+		if len(row.Errors) == 0 {
+			if seen[key] {
+				row.Duplicate = true
+			} else if exists, err := movieScheduled(row.Movie.Title, row.Movie.Time); err != nil {
+				return mi, err
+			} else {
+				row.Duplicate = exists
+			}
+			seen[key] = true
+		}
+
+		// New screenings mustn't clash with the schedule or with each other
+		if len(row.Errors) == 0 && !row.Duplicate {
+			if err := checkSchedule(row.Movie, scheduled...); err != nil {
+				row.Errors = append(row.Errors, err.Error())
+			} else if slot, err := screeningSlot(row.Movie, buffer); err == nil {
+				scheduled = append(scheduled, slot)
+			}
+		}
+
+		if len(row.Errors) > 0 {
+			mi.Errors++
+		} else if row.Duplicate {
+			mi.Duplicates++
+		}
+		mi.Rows = append(mi.Rows, row)
+	}
+
+	return mi, nil
+}
+
+// validateImportRecord turns one record into a movie and lists what's wrong with it
+func validateImportRecord(line int, record map[string]string) MovieImportRow {
+	row := MovieImportRow{Line: line}
+	m := &row.Movie
+
+	m.Title = record["title"]
+	m.Image = record["image"]
+	m.Auditorium = record["auditorium"]
+	m.Genre = record["genre"]
+	m.AgeRating = record["age_rating"]
+	m.Synopsis = record["synopsis"]
+	m.Cast = record["cast"]
+	m.Director = record["director"]
+	m.Language = record["language"]
+	m.ReleaseDate = record["release_date"]
+	m.TrailerURL = record["trailer"]
+
+	if m.Title == "" {
+		row.Errors = append(row.Errors, "title is required")
+	}
+	if record["time"] == "" {
+		row.Errors = append(row.Errors, "time is required")
+	} else if showtime, err := parseShowtime(record["time"]); err != nil {
+		row.Errors = append(row.Errors, err.Error())
+	} else {
+		m.Time = showtime
+	}
+	runtime := record["runtime"]
+	if runtime == "" {
+		runtime = record["duration"]
+	}
+	if minutes, err := parseRuntime(runtime); err != nil {
+		row.Errors = append(row.Errors, err.Error())
+	} else {
+		m.Runtime = minutes
+	}
+	m.Currency = record["currency"]
+	if err := normalizeMovieDetails(m); err != nil {
+		row.Errors = append(row.Errors, err.Error())
+	}
+	price, err := parseMoney(record["price"], m.Currency)
+	if err != nil || price <= 0 {
+		row.Errors = append(row.Errors, "price must be a positive amount in the movie's currency")
+	}
+	m.Price = price
+	if m.Auditorium == "" {
+		m.Auditorium = defaultAuditorium
+	}
+
+	return row
+}
+
+// movieScheduled reports whether a movie with this title already has this showtime
+func movieScheduled(title string, showtime time.Time) (bool, error) {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM movies WHERE lower(title) = lower(?) AND starts_at = ?",
+		title, showtime.UTC(),
+	).Scan(&count)
+	return count > 0, err
+}
+
+// commitMovieImport saves every new movie in a single transaction, skipping
+// duplicates. Nothing is saved if the import has validation errors.
+func commitMovieImport(mi MovieImport) (int, error) {
+	if !mi.Valid() {
+		return 0, fmt.Errorf("%d row(s) have errors", mi.Errors)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	added := 0
+	for _, row := range mi.Rows {
+		if row.Duplicate {
+			continue
+		}
+		movie := row.Movie
+		if err := saveMovieTx(tx, &movie); err != nil {
+			return 0, fmt.Errorf("line %d: %v", row.Line, err)
+		}
+		added++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// summary describes a committed import for the audit log
+func (mi MovieImport) summary(added int) map[string]interface{} {
+	var titles []string
+	for _, row := range mi.Rows {
+		if !row.Duplicate {
+			titles = append(titles, row.Movie.Title+" "+row.Movie.ShowtimeLabel())
+		}
+	}
+	return map[string]interface{}{
+		"added":      added,
+		"duplicates": mi.Duplicates,
+		"movies":     titles,
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// adminImportHandler uploads a CSV or JSON programme, previews it and, once
+// confirmed, imports it. The preview carries the file content so the commit
+// imports exactly what was reviewed.
+func adminImportHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+
+	data := struct {
+		User         User
+		Import       *MovieImport
+		Content      string
+		Format       string
+		Error        string
+		Message      string
+		SiteCurrency string
+	}{User: user, SiteCurrency: siteCurrency()}
+
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize+1<<20)
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			httpError(w, r, http.StatusBadRequest, "Error parsing form")
+			return
+		}
+
+		var content []byte
+		filename := ""
+		if file, header, err := r.FormFile("file"); err == nil {
+			defer file.Close()
+			content, err = io.ReadAll(io.LimitReader(file, maxImportSize+1))
+			if err != nil {
+				httpError(w, r, http.StatusBadRequest, "Error reading file")
+				return
+			}
+			filename = header.Filename
+		} else {
+			content = []byte(r.FormValue("content"))
+		}
+
+		format, err := importFormat(r.FormValue("format"), filename)
+		switch {
+		case len(content) == 0:
+			data.Error = "Choose a CSV or JSON file to import"
+		case len(content) > maxImportSize:
+			data.Error = "The file is too large"
+		case err != nil:
+			data.Error = err.Error()
+		default:
+			mi, err := parseMovieImport(content, format)
+			if err != nil {
+				data.Error = err.Error()
+				break
+			}
+			data.Import = &mi
+			data.Content = string(content)
+			data.Format = format
+
+			if r.FormValue("action") == "commit" {
+				added, err := commitMovieImport(mi)
+				if err != nil {
+					data.Error = "Nothing was imported: " + err.Error()
+					break
+				}
+				loadMovies()
+				recordAudit(r, user, "movie.import", "import", "upload", nil, mi.summary(added))
+				log.Printf("Admin %s imported %d movies", user.Email, added)
+				data.Import = nil
+				data.Message = fmt.Sprintf("Imported %d movie(s), skipped %d duplicate(s)", added, mi.Duplicates)
+			}
+		}
+	}
+
+	err := templates.Render(w, r, "admin_import", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func countMovies(t *testing.T, title string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM movies WHERE title = ?", title).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestParseMovieImportCSV(t *testing.T) {
+	newTestSite(t)
+
+	// Spreadsheet exports start with a byte order mark, and files written for
+	// older versions call the runtime "duration"
+	data := "\ufeffTitle, Time, Duration, Price, Currency, Auditorium\n" +
+		"Alpha,2030-01-10 18:00,2h 5m,12.50,USD,Main Hall\n" +
+		"Beta,2030-01-10 18:00,95,9,EUR,Studio\n"
+	mi, err := parseMovieImport([]byte(data), "csv")
+	if err != nil {
+		t.Fatalf("parseMovieImport: %v", err)
+	}
+	if !mi.Valid() || mi.New() != 2 {
+		t.Fatalf("%d errors, %d new, want 0 and 2: %+v", mi.Errors, mi.New(), mi.Rows)
+	}
+
+	alpha := mi.Rows[0]
+	if alpha.Line != 2 || alpha.Movie.Title != "Alpha" || alpha.Movie.Runtime != 125 ||
+		alpha.Movie.Price != 1250 || alpha.Movie.Auditorium != "Main Hall" || alpha.Movie.ShowtimeLabel() != "2030-01-10 18:00" {
+		t.Errorf("first row = line %d %+v", alpha.Line, alpha.Movie)
+	}
+	if beta := mi.Rows[1].Movie; beta.Price != 900 || beta.Currency != "EUR" {
+		t.Errorf("second row price = %d %s, want 900 EUR", beta.Price, beta.Currency)
+	}
+
+	for _, bad := range []string{"", "title,time,price\nAlpha,2030-01-10 18:00,12"} {
+		if _, err := parseMovieImport([]byte(bad), "csv"); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+func TestParseMovieImportJSON(t *testing.T) {
+	newTestSite(t)
+
+	data := `[
+		{"title": "Gamma", "time": "2030-01-11 18:00", "runtime": 95, "price": 19.99, "currency": "USD"},
+		{"Title": "Delta", "Time": "2030-01-11T21:00", "Runtime": "1h 40m", "Price": "7", "Auditorium": "Studio"},
+		{"title": "Epsilon", "time": "2030-01-12 18:00", "runtime": 95, "price": 12.345, "currency": "USD"}
+	]`
+	mi, err := parseMovieImport([]byte(data), "json")
+	if err != nil {
+		t.Fatalf("parseMovieImport: %v", err)
+	}
+
+	// Prices stay as written instead of going through a float
+	if gamma := mi.Rows[0]; len(gamma.Errors) != 0 || gamma.Movie.Price != 1999 || gamma.Movie.Runtime != 95 {
+		t.Errorf("Gamma = %+v, errors %v", gamma.Movie, gamma.Errors)
+	}
+	if delta := mi.Rows[1]; len(delta.Errors) != 0 || delta.Movie.Title != "Delta" || delta.Movie.Runtime != 100 || delta.Movie.Price != 700 {
+		t.Errorf("Delta = %+v, errors %v", delta.Movie, delta.Errors)
+	}
+	if epsilon := mi.Rows[2]; len(epsilon.Errors) != 1 || !strings.Contains(epsilon.Errors[0], "price") {
+		t.Errorf("Epsilon errors = %v, want one about the price", epsilon.Errors)
+	}
+	if mi.Errors != 1 || mi.Valid() {
+		t.Errorf("%d errors, valid %v", mi.Errors, mi.Valid())
+	}
+
+	if _, err := parseMovieImport([]byte(`{"title": "Not a list"}`), "json"); err == nil {
+		t.Error("an object instead of a list was accepted")
+	}
+}
+
+func TestMovieImportDuplicatesAndClashes(t *testing.T) {
+	newTestSite(t)
+
+	data := "title,time,runtime,price\n" +
+		"Zeta,2030-02-01 18:00,90,10\n" +
+		"ZETA,2030-02-01 18:00,90,10\n" + // the same screening twice
+		"Eta,2030-02-01 19:00,90,10\n" + // overlaps Zeta in the same auditorium
+		"Theta,2030-02-01 21:00,90,10\n"
+	mi, err := parseMovieImport([]byte(data), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mi.Rows[1].Duplicate || mi.Duplicates != 1 {
+		t.Errorf("repeated row: duplicate %v, %d duplicates", mi.Rows[1].Duplicate, mi.Duplicates)
+	}
+	if len(mi.Rows[2].Errors) == 0 || mi.Errors != 1 {
+		t.Errorf("clashing row errors %v, %d errors in total", mi.Rows[2].Errors, mi.Errors)
+	}
+	if _, err := commitMovieImport(mi); err == nil {
+		t.Error("an import with errors was committed")
+	}
+	if n := countMovies(t, "Zeta"); n != 0 {
+		t.Errorf("%d Zeta screenings saved from an invalid import", n)
+	}
+
+	// Without the clash, only new screenings are added
+	data = strings.Replace(data, "Eta,2030-02-01 19:00", "Eta,2030-02-02 19:00", 1)
+	mi, err = parseMovieImport([]byte(data), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := commitMovieImport(mi)
+	if err != nil || added != 3 {
+		t.Fatalf("commitMovieImport = %d, %v, want 3 added", added, err)
+	}
+
+	// Importing the same file again finds every screening already scheduled
+	mi, err = parseMovieImport([]byte(data), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi.Duplicates != 4 || mi.New() != 0 {
+		t.Errorf("re-import: %d duplicates, %d new, want 4 and 0", mi.Duplicates, mi.New())
+	}
+	if added, err := commitMovieImport(mi); err != nil || added != 0 {
+		t.Errorf("re-import added %d, %v", added, err)
+	}
+	if n := countMovies(t, "Zeta"); n != 1 {
+		t.Errorf("%d Zeta screenings, want 1", n)
+	}
+}
+
+func TestMovieImportCommitsAllOrNothing(t *testing.T) {
+	newTestSite(t)
+
+	// Make the database refuse the last movie, after the others are written
+	_, err := db.Exec(`CREATE TRIGGER refuse_iota BEFORE INSERT ON movies
+        WHEN NEW.title = 'Iota' BEGIN SELECT RAISE(ABORT, 'refused'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := "title,time,runtime,price\n" +
+		"Kappa,2030-03-01 18:00,90,10\n" +
+		"Lambda,2030-03-02 18:00,90,10\n" +
+		"Iota,2030-03-03 18:00,90,10\n"
+	mi, err := parseMovieImport([]byte(data), "csv")
+	if err != nil || !mi.Valid() {
+		t.Fatalf("parseMovieImport: %v, %+v", err, mi.Rows)
+	}
+	if _, err := commitMovieImport(mi); err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Fatalf("commitMovieImport error = %v, want one for line 4", err)
+	}
+	for _, title := range []string{"Kappa", "Lambda"} {
+		if n := countMovies(t, title); n != 0 {
+			t.Errorf("%s was saved although the import failed", title)
+		}
+	}
+}
+
+func TestMovieImportExplainsDSTGap(t *testing.T) {
+	newTestSite(t)
+	setCinemaZone(t, "America/New_York")
+
+	mi, err := parseMovieImport([]byte("title,time,runtime,price\nMu,2030-03-10 02:30,90,10\n"), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := mi.Rows[0].Errors; len(errs) != 1 || !strings.Contains(errs[0], "clocks go forward") {
+		t.Errorf("errors = %v, want one about the clocks going forward", errs)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// sendMail delivers a plain-text email through the SMTP server in
+// MOOBEE_SMTP_ADDR. Without one configured the message is skipped and only
+// that fact is logged, since emails carry customers' details.
+func sendMail(to, subject, body string) error {
+	addr := envOr("MOOBEE_SMTP_ADDR", "")
+	from := envOr("MOOBEE_MAIL_FROM", "Moobee <no-reply@localhost>")
+
+	if addr == "" {
+		log.Printf("Email not sent, MOOBEE_SMTP_ADDR is not set")
+		return nil
+	}
+
+	var auth smtp.Auth
+	if user := envOr("MOOBEE_SMTP_USER", ""); user != "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", user, envOr("MOOBEE_SMTP_PASSWORD", ""), host)
+	}
+
+	// Strip line breaks so header values can't inject extra headers
+	clean := strings.NewReplacer("\r", "", "\n", "")
+	msg := "From: " + clean.Replace(from) + "\r\n" +
+		"To: " + clean.Replace(to) + "\r\n" +
+		"Subject: " + clean.Replace(subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+
+	fromAddr := from
+	if start, end := strings.LastIndex(from, "<"), strings.LastIndex(from, ">"); start >= 0 && end > start {
+		fromAddr = from[start+1 : end]
+	}
+
+	return smtp.SendMail(addr, auth, fromAddr, []string{to}, []byte(msg))
+}
+
+// sendBookingConfirmation emails the booking details to the customer
+func sendBookingConfirmation(bookingID int) error {
+	var b Booking
+	err := db.QueryRow(
+		"SELECT id, name, email, movie_id, total_minor, currency, date, status FROM bookings WHERE id = ?",
+		bookingID,
+	).Scan(&b.ID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Currency, &b.Date, &b.Status)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("booking %d not found", bookingID)
+	} else if err != nil {
+		return err
+	}
+	b.Seats = getBookingSeats(b.ID)
+
+	title := fmt.Sprintf("Movie ID %d", b.MovieID)
+	showtime := ""
+	if movie := getMovie(b.MovieID); movie != nil {
+		title = movie.Title
+		showtime = formatShowtime(movie.Time)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\n", b.Name)
+	if b.Status == bookingConfirmed {
+		fmt.Fprintf(&body, "Your booking for %s is confirmed.\n\n", title)
+	} else {
+		fmt.Fprintf(&body, "Your booking for %s has been %s.\n\n", title, b.Status)
+	}
+	fmt.Fprintf(&body, "Booking: #%d\n", b.ID)
+	if showtime != "" {
+		fmt.Fprintf(&body, "Showtime: %s\n", showtime)
+	}
+	fmt.Fprintf(&body, "Seats: %s\n", strings.Join(b.Seats, ", "))
+	fmt.Fprintf(&body, "Total: %s\n\n", formatPrice(b.Total, b.Currency))
+	fmt.Fprintf(&body, "View your booking at %s/booking/%d\n", baseURL(), b.ID)
+
+	return sendMail(b.Email, fmt.Sprintf("Your Moobee booking #%d", b.ID), body.String())
+}
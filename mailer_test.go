@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSendMailWithoutSMTPLogsNoDetails(t *testing.T) {
+	t.Setenv("MOOBEE_SMTP_ADDR", "")
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	if err := sendMail("customer@example.com", "Your Moobee booking #7", "Seats: A1, A2"); err != nil {
+		t.Fatalf("sendMail: %v", err)
+	}
+	for _, detail := range []string{"customer@example.com", "booking #7", "A1"} {
+		if strings.Contains(buf.String(), detail) {
+			t.Errorf("log %q contains %q", buf.String(), detail)
+		}
+	}
+}
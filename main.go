@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
 	"log"
 	"net/http"
 	"os"
@@ -14,33 +15,57 @@ import (
 )
 
 var (
-	movies      []Movie
-	mutex       sync.Mutex
-	templates   *template.Template
-	cssTemplate *template.Template // Add this line
+	movies    []Movie
+	mutex     sync.Mutex
+	templates *TemplateSet
 )
 
 type Movie struct {
-	ID       int      `json:"id"`
-	Title    string   `json:"title"`
-	Time     string   `json:"time"`
-	Duration string   `json:"duration"`
-	Image    string   `json:"image"`
-	Price    float64  `json:"price"`
-	Seats    [][]bool `json:"-"` // Not stored in DB directly, loaded separately
+	ID          int               `json:"id"`
+	Title       string            `json:"title"`
+	Time        time.Time         `json:"time"`    // UTC
+	Runtime     int               `json:"runtime"` // minutes
+	Image       string            `json:"image"`
+	Price       Money             `json:"price"`    // minor units of Currency
+	Currency    string            `json:"currency"` // ISO 4217
+	Auditorium  string            `json:"auditorium"`
+	Genre       string            `json:"genre"`
+	AgeRating   string            `json:"ageRating"`
+	Synopsis    string            `json:"synopsis"`
+	Cast        string            `json:"cast"` // comma-separated
+	Director    string            `json:"director"`
+	Language    string            `json:"language"`
+	ReleaseDate string            `json:"releaseDate"` // YYYY-MM-DD
+	TrailerURL  string            `json:"trailerURL"`
+	Poster      string            `json:"-"` // resized poster renditions, see posters.go
+	Seats       [][]bool          `json:"-"` // Not stored in DB directly, loaded separately
+	Blocks      map[string]string `json:"-"` // Blocked and house seats by seat ID
 }
 
 type Booking struct {
-	ID      int
-	UserID  int
-	Name    string
-	Email   string
-	MovieID int
-	Seats   []string
-	Total   float64
-	Date    time.Time
+	ID       int       `json:"id"`
+	UserID   int       `json:"userID,omitempty"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	MovieID  int       `json:"movieID"`
+	Seats    []string  `json:"seats"`
+	Total    Money     `json:"total"`    // minor units of Currency
+	Currency string    `json:"currency"` // what the total was charged in
+	Date     time.Time `json:"date"`
+	Status   string    `json:"status"`
+
+	PaymentMethod string `json:"paymentMethod,omitempty"`
 }
 
+// Booking statuses
+const (
+	bookingConfirmed = "confirmed"
+	bookingCancelled = "cancelled"
+	bookingRefunded  = "refunded"
+)
+
+var errBookingNotActive = errors.New("booking is not active")
+
 type BookingResponse struct {
 	Success   bool
 	Message   string
@@ -62,76 +87,98 @@ func main() {
 	}
 	defer db.Close()
 
-	// Create static directories
-	os.MkdirAll("static/images", 0755)
+	// Set up where uploaded posters are stored
+	if err := initAssetStore(); err != nil {
+		log.Fatalf("Asset storage initialization failed: %v", err)
+	}
+
+	// Run a command-line subcommand instead of the server when one is given
+	if handled, err := runCommand(os.Args[1:]); handled {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Make sure an admin exists, or start the first-run setup
+	if err := ensureAdminUser(); err != nil {
+		log.Printf("Warning: Failed to check for admin user: %v", err)
+	}
 
 	// Load movies (call the function from admin.go)
 	loadMovies()
+	loadBrands()
 
 	// Initialize templates
 	initTemplates()
 
-	// Setup routes for static files and handlers
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
-
-	// Setup API routes
-	http.HandleFunc("/api/book", apiBookHandler)
-
-	// Setup page routes
-	http.HandleFunc("/", landingHandler)  // Landing page is now the root
-	http.HandleFunc("/home", homeHandler) // Home page moved to /home
-	http.HandleFunc("/book/", bookHandler)
-	http.HandleFunc("/booking/", viewBookingHandler)
-	http.HandleFunc("/bookings", bookingsHandler)
-	http.HandleFunc("/cancel/", cancelBookingHandler)
-	http.HandleFunc("/login", loginHandler)
-	http.HandleFunc("/logout", logoutHandler)
-	http.HandleFunc("/register", registerHandler)
-	http.HandleFunc("/profile", profileHandler)
-	http.HandleFunc("/search", searchHandler)
-	http.HandleFunc("/admin", adminHandler)
-	http.HandleFunc("/admin/movies", adminMovieHandler)
-	http.HandleFunc("/admin/movies/delete/", adminDeleteMovieHandler)
-
-	// Also register the CSS handler
-	http.HandleFunc("/static/styles.css", staticHandler)
+	// Discover configured single sign-on providers
+	initOIDC(context.Background())
 
 	// Start the server
 	log.Println("Starting server on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Fatal(http.ListenAndServe(":8080", routes()))
 }
 
-func initTemplates() {
-	// Create new template with custom functions
-	templates = template.New("").Funcs(template.FuncMap{
-		"availableSeats": availableSeats,
-		"formatPrice":    formatPrice,
-		"add":            func(a, b int) int { return a + b },
-		"getMovie":       getMovie,
-	})
+// routes registers every handler on a new mux, wrapped in the middleware
+// that applies to all requests
+func routes() http.Handler {
+	mux := http.NewServeMux()
+
+	// Setup routes for static files and handlers
+	mux.HandleFunc("/static/", staticHandler)
+	mux.Handle("/uploads/", http.StripPrefix("/uploads/", uploadsHandler()))
 
-	// Parse all templates
-	templates.New("landing").Parse(landingTemplate) // Add this line
-	templates.New("home").Parse(homeTemplate)
-	templates.New("book").Parse(bookTemplate)
-	templates.New("bookings").Parse(bookingsTemplate)
-	templates.New("view_booking").Parse(viewBookingTemplate)
-	templates.New("login").Parse(loginTemplate)
-	templates.New("register").Parse(registerTemplate)
-	templates.New("profile").Parse(profileTemplate)
-	templates.New("admin").Parse(adminTemplate)
-	templates.New("admin_movies").Parse(adminMoviesTemplate)
-	templates.New("search").Parse(searchTemplate)
-
-	// This is for the static css handler
-	cssTemplate = template.Must(template.New("css").Parse(cssContent))
+	// Setup API routes
+	mux.HandleFunc("/api/book", guestAPIMiddleware(scopeBookingsWrite, apiBookHandler))
+	mux.HandleFunc("/api/bookings", apiMiddleware(scopeBookingsRead, apiBookingsHandler))
+	mux.HandleFunc("/api/movies", apiMoviesHandler)
+	mux.HandleFunc("/api/movies/", apiMiddleware(scopeMoviesWrite, apiMovieHandler))
+
+	// Setup page routes
+	mux.HandleFunc("/", landingHandler)  // Landing page is now the root
+	mux.HandleFunc("/home", homeHandler) // Home page moved to /home
+	mux.HandleFunc("/book/", bookHandler)
+	mux.HandleFunc("/booking/", viewBookingHandler)
+	mux.HandleFunc("/bookings", bookingsHandler)
+	mux.HandleFunc("/cancel/", cancelBookingHandler)
+	mux.HandleFunc("/setup", setupHandler)
+	mux.HandleFunc("/login", loginHandler)
+	mux.HandleFunc("/login/2fa", loginMFAHandler)
+	mux.HandleFunc("/auth/oidc/", oidcHandler)
+	mux.HandleFunc("/logout", logoutHandler)
+	mux.HandleFunc("/register", registerHandler)
+	mux.HandleFunc("/profile", profileHandler)
+	mux.HandleFunc("/profile/2fa", profileTwoFactorHandler)
+	mux.HandleFunc("/profile/tokens", profileTokensHandler)
+	mux.HandleFunc("/profile/locale", setLocaleHandler)
+	mux.HandleFunc("/search", searchHandler)
+	mux.HandleFunc("/posters/placeholder.svg", placeholderHandler)
+	mux.HandleFunc("/admin", adminMiddleware(adminHandler))
+	mux.HandleFunc("/admin/security", adminMiddleware(adminSecurityHandler))
+	mux.HandleFunc("/admin/movies", adminMiddleware(adminMovieHandler))
+	mux.HandleFunc("/admin/movies/delete/", adminMiddleware(adminDeleteMovieHandler))
+	mux.HandleFunc("/admin/movies/import", adminMiddleware(adminImportHandler))
+	mux.HandleFunc("/admin/movies/seats/", adminMiddleware(adminSeatsHandler))
+	mux.HandleFunc("/admin/bookings", adminMiddleware(adminBookingsHandler))
+	mux.HandleFunc("/admin/reports", adminMiddleware(adminReportsHandler))
+	mux.HandleFunc("/admin/audit", adminMiddleware(adminAuditHandler))
+	mux.HandleFunc("/admin/brands", adminMiddleware(adminBrandsHandler))
+	mux.HandleFunc("/admin/users", adminMiddleware(adminUsersHandler))
+	mux.HandleFunc("/admin/users/", adminMiddleware(adminUserHandler))
+	mux.HandleFunc("/pos", staffMiddleware(posHandler))
+	mux.HandleFunc("/pos/sell/", staffMiddleware(posSellHandler))
+	mux.HandleFunc("/pos/tickets/", staffMiddleware(posTicketsHandler))
+	mux.HandleFunc("/pos/shift/", staffMiddleware(posShiftHandler))
+
+	return recoverMiddleware(setupMiddleware(mux))
 }
 
 func bookHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Path[len("/book/"):]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid movie ID", http.StatusBadRequest)
+		httpError(w, r, http.StatusBadRequest, "Invalid movie ID")
 		return
 	}
 
@@ -144,7 +191,7 @@ func bookHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if movie == nil {
-		http.Error(w, "Movie not found", http.StatusNotFound)
+		httpError(w, r, http.StatusNotFound, "Movie not found")
 		return
 	}
 
@@ -159,15 +206,15 @@ func bookHandler(w http.ResponseWriter, r *http.Request) {
 		User:  user,
 	}
 
-	err = templates.ExecuteTemplate(w, "book", data)
+	err = templates.Render(w, r, "book", data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
 func apiBookHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httpError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -199,104 +246,33 @@ func apiBookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mutex.Lock()
-	defer mutex.Unlock()
+	// Bookings made with a token or session belong to that user; guests
+	// have none
+	user, _ := requestUser(r)
 
-	// Check seat availability
-	for _, seatStr := range req.Seats {
-		var row, col int
-		fmt.Sscanf(seatStr, "%d-%d", &row, &col)
-		if row >= len(movie.Seats) || col >= len(movie.Seats[row]) || movie.Seats[row][col] {
-			sendJSONResponse(w, BookingResponse{Success: false, Message: fmt.Sprintf("Seat %s is not available", seatStr)})
-			return
-		}
-	}
+	mutex.Lock()
+	bookingID, err := createBooking(movie, req.Seats, req.Name, req.Email, user, bookingSale{})
+	mutex.Unlock()
 
-	// Begin transaction
-	tx, err := db.Begin()
-	if err != nil {
-		sendJSONResponse(w, BookingResponse{Success: false, Message: "Database error"})
+	var unavailable seatUnavailableError
+	if errors.As(err, &unavailable) {
+		sendJSONResponse(w, BookingResponse{Success: false, Message: unavailable.Error()})
 		return
-	}
-	defer tx.Rollback()
-
-	// Get user ID if logged in
-	var userID int
-	user, err := getUserFromSession(r)
-	if err == nil {
-		userID = user.ID
-	}
-
-	// Calculate total price
-	total := float64(len(req.Seats)) * movie.Price
-
-	// Create booking
-	result, err := tx.Exec(
-		"INSERT INTO bookings (user_id, name, email, movie_id, total) VALUES (?, ?, ?, ?, ?)",
-		userID, req.Name, req.Email, movie.ID, total,
-	)
-	if err != nil {
+	} else if err != nil {
+		log.Printf("Error creating booking: %v", err)
 		sendJSONResponse(w, BookingResponse{Success: false, Message: "Error creating booking"})
 		return
 	}
 
-	// Get the booking ID
-	bookingID, err := result.LastInsertId()
-	if err != nil {
-		sendJSONResponse(w, BookingResponse{Success: false, Message: "Error getting booking ID"})
-		return
-	}
-
-	// Save the seats
-	for _, seatStr := range req.Seats {
-		var row, col int
-		fmt.Sscanf(seatStr, "%d-%d", &row, &col)
-
-		// Update the seats table
-		_, err = tx.Exec(
-			"UPDATE seats SET is_booked = 1 WHERE movie_id = ? AND row = ? AND col = ?",
-			movie.ID, row, col,
-		)
-		if err != nil {
-			sendJSONResponse(w, BookingResponse{Success: false, Message: "Error updating seat"})
-			return
-		}
-
-		// Insert into booking_seats
-		_, err = tx.Exec(
-			"INSERT INTO booking_seats (booking_id, row, col) VALUES (?, ?, ?)",
-			bookingID, row, col,
-		)
-		if err != nil {
-			sendJSONResponse(w, BookingResponse{Success: false, Message: "Error saving seat selection"})
-			return
-		}
-
-		// Update in-memory seats
-		movie.Seats[row][col] = true
-	}
-
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		sendJSONResponse(w, BookingResponse{Success: false, Message: "Error finalizing booking"})
-		return
-	}
-
 	sendJSONResponse(w, BookingResponse{
 		Success:   true,
 		Message:   "Booking successful",
-		BookingID: int(bookingID),
+		BookingID: bookingID,
 	})
 }
 
 func sendJSONResponse(w http.ResponseWriter, response BookingResponse) {
-	jsonResponse, err := json.Marshal(response)
-	if err != nil {
-		http.Error(w, "Error creating JSON response", http.StatusInternalServerError)
-		return
-	}
-
-	w.Write(jsonResponse)
+	writeJSON(w, http.StatusOK, response)
 }
 
 func bookingsHandler(w http.ResponseWriter, r *http.Request) {
@@ -306,20 +282,42 @@ func bookingsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	bookings, err := listBookings(user)
+	if err != nil {
+		serverError(w, r, fmt.Errorf("loading bookings: %w", err))
+		return
+	}
+
+	data := struct {
+		Bookings []Booking
+		User     User
+	}{
+		Bookings: bookings,
+		User:     user,
+	}
+
+	if err := templates.Render(w, r, "bookings", data); err != nil {
+		serverError(w, r, fmt.Errorf("rendering page: %w", err))
+	}
+}
+
+// listBookings returns the bookings visible to user, newest first. Admins see all bookings.
+func listBookings(user User) ([]Booking, error) {
 	var bookings []Booking
 	var rows *sql.Rows
+	var err error
 
 	if user.IsAdmin {
 		// Admins see all bookings
 		rows, err = db.Query(`
-            SELECT b.id, b.user_id, b.name, b.email, b.movie_id, b.total, b.date 
+            SELECT b.id, b.user_id, b.name, b.email, b.movie_id, b.total_minor, b.currency, b.date, b.status 
             FROM bookings b 
             ORDER BY b.date DESC
         `)
 	} else {
 		// Regular users see only their bookings
 		rows, err = db.Query(`
-            SELECT b.id, b.user_id, b.name, b.email, b.movie_id, b.total, b.date 
+            SELECT b.id, b.user_id, b.name, b.email, b.movie_id, b.total_minor, b.currency, b.date, b.status 
             FROM bookings b 
             WHERE b.user_id = ? OR b.email = ?
             ORDER BY b.date DESC
@@ -327,8 +325,7 @@ func bookingsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		http.Error(w, "Error loading bookings", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -336,7 +333,7 @@ func bookingsHandler(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var b Booking
 		var userID sql.NullInt64
-		if err := rows.Scan(&b.ID, &userID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Date); err != nil {
+		if err := rows.Scan(&b.ID, &userID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Currency, &b.Date, &b.Status); err != nil {
 			log.Printf("Error scanning booking row: %v", err)
 			continue
 		}
@@ -350,18 +347,7 @@ func bookingsHandler(w http.ResponseWriter, r *http.Request) {
 		bookings = append(bookings, b)
 	}
 
-	data := struct {
-		Bookings []Booking
-		User     User
-	}{
-		Bookings: bookings,
-		User:     user,
-	}
-
-	if err := templates.ExecuteTemplate(w, "bookings", data); err != nil {
-		log.Printf("Error executing template: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	return bookings, nil
 }
 
 func getBookingSeats(bookingID int) []string {
@@ -392,7 +378,7 @@ func viewBookingHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Path[len("/booking/"):]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		httpError(w, r, http.StatusBadRequest, "Invalid booking ID")
 		return
 	}
 
@@ -400,13 +386,13 @@ func viewBookingHandler(w http.ResponseWriter, r *http.Request) {
 	var booking Booking
 	var userID sql.NullInt64
 	err = db.QueryRow(`
-        SELECT id, user_id, name, email, movie_id, total, date 
+        SELECT id, user_id, name, email, movie_id, total_minor, currency, date, status 
         FROM bookings 
         WHERE id = ?
-    `, id).Scan(&booking.ID, &userID, &booking.Name, &booking.Email, &booking.MovieID, &booking.Total, &booking.Date)
+    `, id).Scan(&booking.ID, &userID, &booking.Name, &booking.Email, &booking.MovieID, &booking.Total, &booking.Currency, &booking.Date, &booking.Status)
 
 	if err != nil {
-		http.Error(w, "Booking not found", http.StatusNotFound)
+		httpError(w, r, http.StatusNotFound, "Booking not found")
 		return
 	}
 
@@ -422,7 +408,7 @@ func viewBookingHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the user is authorized to view this booking
 	if !user.IsAdmin && user.ID != booking.UserID && user.Email != booking.Email {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		httpError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -434,9 +420,9 @@ func viewBookingHandler(w http.ResponseWriter, r *http.Request) {
 		User:    user,
 	}
 
-	err = templates.ExecuteTemplate(w, "view_booking", data)
+	err = templates.Render(w, r, "view_booking", data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
@@ -444,7 +430,7 @@ func cancelBookingHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Path[len("/cancel/"):]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		httpError(w, r, http.StatusBadRequest, "Invalid booking ID")
 		return
 	}
 
@@ -455,28 +441,17 @@ func cancelBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	// Begin transaction
-	tx, err := db.Begin()
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	defer tx.Rollback()
-
 	// Get the booking
 	var booking Booking
 	var userID sql.NullInt64
-	err = tx.QueryRow(`
+	err = db.QueryRow(`
         SELECT id, user_id, email, movie_id
         FROM bookings 
         WHERE id = ?
     `, id).Scan(&booking.ID, &userID, &booking.Email, &booking.MovieID)
 
 	if err != nil {
-		http.Error(w, "Booking not found", http.StatusNotFound)
+		httpError(w, r, http.StatusNotFound, "Booking not found")
 		return
 	}
 
@@ -486,97 +461,234 @@ func cancelBookingHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the user is authorized to cancel this booking
 	if !user.IsAdmin && user.ID != booking.UserID && user.Email != booking.Email {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		httpError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Get the seats
-	rows, err := tx.Query(
-		"SELECT row, col FROM booking_seats WHERE booking_id = ?",
-		id,
+	mutex.Lock()
+	previous, err := cancelBooking(id, bookingCancelled)
+	mutex.Unlock()
+
+	if err == errBookingNotActive {
+		httpError(w, r, http.StatusConflict, "This booking has already been cancelled")
+		return
+	} else if err != nil {
+		serverError(w, r, fmt.Errorf("cancelling booking %d: %w", id, err))
+		return
+	}
+
+	recordAudit(r, user, "booking.cancel", "booking", id,
+		map[string]string{"status": previous}, map[string]string{"status": bookingCancelled})
+
+	http.Redirect(w, r, "/bookings", http.StatusSeeOther)
+}
+
+// bookingSale records how a box-office booking was paid for and who sold it.
+// Online bookings leave it empty.
+type bookingSale struct {
+	PaymentMethod string
+	SoldBy        int
+	ShiftID       int
+}
+
+// seatUnavailableError reports a requested seat that can't be sold
+type seatUnavailableError struct {
+	seat string
+}
+
+func (e seatUnavailableError) Error() string {
+	return fmt.Sprintf("Seat %s is not available", e.seat)
+}
+
+// createBooking books the seats for the movie and returns the booking ID.
+// Blocked seats are never sold and house seats only by admins and staff.
+// The caller must hold mutex.
+func createBooking(movie *Movie, seats []string, name, email string, user User, sale bookingSale) (int, error) {
+	// Check seat availability
+	requested := make(map[string]bool)
+	for _, seatStr := range seats {
+		row, col, err := parseSeat(seatStr)
+		if err != nil || requested[seatStr] || !movie.seatAvailable(row, col, user.IsAdmin || user.IsStaff) {
+			return 0, seatUnavailableError{seatStr}
+		}
+		requested[seatStr] = true
+	}
+
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Calculate total price
+	total := movie.Price.Times(len(seats))
+
+	var userID, soldBy, shiftID interface{}
+	if user.ID != 0 {
+		userID = user.ID
+	}
+	if sale.PaymentMethod == "" {
+		sale.PaymentMethod = paymentOnline
+	}
+	if sale.SoldBy != 0 {
+		soldBy = sale.SoldBy
+		shiftID = sale.ShiftID
+	}
+
+	// Create booking
+	result, err := tx.Exec(
+		"INSERT INTO bookings (user_id, name, email, movie_id, total_minor, currency, payment_method, sold_by, shift_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, name, email, movie.ID, total, movie.Currency, sale.PaymentMethod, soldBy, shiftID,
 	)
 	if err != nil {
-		http.Error(w, "Error getting booking seats", http.StatusInternalServerError)
-		return
+		return 0, err
+	}
+
+	// Get the booking ID
+	bookingID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// Save the seats
+	for _, seatStr := range seats {
+		row, col, _ := parseSeat(seatStr)
+
+		// Update the seats table
+		_, err = tx.Exec(
+			"UPDATE seats SET is_booked = 1 WHERE movie_id = ? AND row = ? AND col = ?",
+			movie.ID, row, col,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		// Insert into booking_seats
+		_, err = tx.Exec(
+			"INSERT INTO booking_seats (booking_id, row, col) VALUES (?, ?, ?)",
+			bookingID, row, col,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return 0, err
 	}
 
+	// Update in-memory seats
+	for _, seatStr := range seats {
+		row, col, _ := parseSeat(seatStr)
+		movie.Seats[row][col] = true
+	}
+
+	return int(bookingID), nil
+}
+
+// cancelBooking releases a booking's seats and marks it cancelled or refunded.
+// A cancelled booking can still be refunded later. It returns the status the
+// booking had before. A refund records the booking's total as the amount paid
+// back. The caller must hold mutex.
+func cancelBooking(id int, status string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var movieID int
+	var current string
+	err = tx.QueryRow("SELECT movie_id, status FROM bookings WHERE id = ?", id).Scan(&movieID, &current)
+	if err != nil {
+		return current, err
+	}
+
+	releaseSeats := current == bookingConfirmed
+	if !releaseSeats && !(current == bookingCancelled && status == bookingRefunded) {
+		return current, errBookingNotActive
+	}
+
+	// Get the seats
 	var seatRows, seatCols []int
-	for rows.Next() {
-		var row, col int
-		if err := rows.Scan(&row, &col); err != nil {
-			rows.Close()
-			http.Error(w, "Error reading seat data", http.StatusInternalServerError)
-			return
+	if releaseSeats {
+		rows, err := tx.Query(
+			"SELECT row, col FROM booking_seats WHERE booking_id = ?",
+			id,
+		)
+		if err != nil {
+			return current, err
 		}
-		seatRows = append(seatRows, row)
-		seatCols = append(seatCols, col)
+
+		for rows.Next() {
+			var row, col int
+			if err := rows.Scan(&row, &col); err != nil {
+				rows.Close()
+				return current, err
+			}
+			seatRows = append(seatRows, row)
+			seatCols = append(seatCols, col)
+		}
+		rows.Close()
 	}
-	rows.Close()
 
 	// Update seats to be available again
 	for i := range seatRows {
 		_, err = tx.Exec(
 			"UPDATE seats SET is_booked = 0 WHERE movie_id = ? AND row = ? AND col = ?",
-			booking.MovieID, seatRows[i], seatCols[i],
+			movieID, seatRows[i], seatCols[i],
 		)
 		if err != nil {
-			http.Error(w, "Error updating seat status", http.StatusInternalServerError)
-			return
-		}
-
-		// Update in-memory seats
-		for j := range movies {
-			if movies[j].ID == booking.MovieID {
-				if seatRows[i] < len(movies[j].Seats) && seatCols[i] < len(movies[j].Seats[seatRows[i]]) {
-					movies[j].Seats[seatRows[i]][seatCols[i]] = false
-				}
-				break
-			}
+			return current, err
 		}
 	}
 
-	// Delete the booking_seats entries
-	_, err = tx.Exec("DELETE FROM booking_seats WHERE booking_id = ?", id)
+	// Keep the booking and its seats for the records, only change the status
+	now := time.Now()
+	_, err = tx.Exec(
+		"UPDATE bookings SET status = ?, cancelled_at = COALESCE(cancelled_at, ?) WHERE id = ?",
+		status, now, id,
+	)
 	if err != nil {
-		http.Error(w, "Error deleting seat reservations", http.StatusInternalServerError)
-		return
+		return current, err
 	}
 
-	// Delete the booking
-	_, err = tx.Exec("DELETE FROM bookings WHERE id = ?", id)
-	if err != nil {
-		http.Error(w, "Error canceling booking", http.StatusInternalServerError)
-		return
+	// Record what was paid back so reports can account for it
+	if status == bookingRefunded {
+		_, err = tx.Exec(
+			"UPDATE bookings SET refund_minor = total_minor, refund_currency = currency, refunded_at = ? WHERE id = ?",
+			now, id,
+		)
+		if err != nil {
+			return current, err
+		}
 	}
 
-	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		http.Error(w, "Error finalizing cancellation", http.StatusInternalServerError)
-		return
+		return current, err
 	}
 
-	http.Redirect(w, r, "/bookings", http.StatusSeeOther)
-}
-
-func staticHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/css")
-	w.Write([]byte(cssContent))
-}
-
-func availableSeats(seats [][]bool) int {
-	count := 0
-	for _, row := range seats {
-		for _, booked := range row {
-			if !booked {
-				count++
+	// Update in-memory seats
+	for j := range movies {
+		if movies[j].ID == movieID {
+			for i := range seatRows {
+				if seatRows[i] < len(movies[j].Seats) && seatCols[i] < len(movies[j].Seats[seatRows[i]]) {
+					movies[j].Seats[seatRows[i]][seatCols[i]] = false
+				}
 			}
+			break
 		}
 	}
-	return count
+
+	return current, nil
 }
 
-func formatPrice(price float64) string {
-	return fmt.Sprintf("$%.2f", price)
+// formatPrice shows a price in the currency for messages that aren't tied
+// to a request, such as emails
+func formatPrice(price Money, currency string) string {
+	return defaultLocale.FormatPrice(price, currency)
 }
 
 func getMovie(id int) *Movie {
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLogWriter sends log output to the test, so it only shows for
+// failures and with -v
+type testLogWriter struct{ t *testing.T }
+
+func (w testLogWriter) Write(p []byte) (int, error) {
+	w.t.Log(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// newTestSite starts the site on a fresh database in a temporary directory,
+// as main does, and returns its handler. Nothing else is created, so the
+// site starts in first-run setup.
+func newTestSite(t *testing.T) http.Handler {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(testLogWriter{t})
+	t.Cleanup(func() {
+		db.Close()
+		os.Chdir(wd)
+		log.SetOutput(os.Stderr)
+	})
+
+	if err := InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	if err := initAssetStore(); err != nil {
+		t.Fatalf("initAssetStore: %v", err)
+	}
+	if err := ensureAdminUser(); err != nil {
+		t.Fatalf("ensureAdminUser: %v", err)
+	}
+	loadMovies()
+	loadBrands()
+	initTemplates()
+	oidcProviders = map[string]*OIDCProvider{}
+
+	return routes()
+}
+
+// createTestUser adds an account with the password "password1"
+func createTestUser(t *testing.T, email string, isAdmin, isStaff bool) User {
+	t.Helper()
+	id, err := registerUser("Test User", email, "password1")
+	if err != nil {
+		t.Fatalf("registerUser: %v", err)
+	}
+	if _, err := db.Exec("UPDATE users SET is_admin = ?, is_staff = ? WHERE id = ?", isAdmin, isStaff, id); err != nil {
+		t.Fatal(err)
+	}
+	if isAdmin {
+		setupPending.Store(false)
+	}
+	user, err := getUser(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// sessionCookie signs the user in and returns their session cookie
+func sessionCookie(t *testing.T, user User) *http.Cookie {
+	t.Helper()
+	token, err := createSession(user.ID, false)
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+	return &http.Cookie{Name: "session", Value: token}
+}
+
+// createTestMovie adds a screening tomorrow
+func createTestMovie(t *testing.T, title string) Movie {
+	t.Helper()
+	movie := Movie{
+		Title:    title,
+		Time:     time.Now().Add(24 * time.Hour).Truncate(time.Minute),
+		Runtime:  120,
+		Price:    1250,
+		Currency: "USD",
+		Genre:    "Drama",
+		Synopsis: "A test screening.",
+		Cast:     "Ann Example, Bo Sample",
+		Director: "Di Rector",
+	}
+	if err := saveMovie(&movie); err != nil {
+		t.Fatalf("saveMovie: %v", err)
+	}
+	loadMovies()
+	return movie
+}
+
+// createTestBooking books one seat of the movie for the user
+func createTestBooking(t *testing.T, movieID int, user User) int {
+	t.Helper()
+	mutex.Lock()
+	defer mutex.Unlock()
+	id, err := createBooking(getMovie(movieID), []string{seatID(0, 0)}, user.Name, user.Email, user, bookingSale{})
+	if err != nil {
+		t.Fatalf("createBooking: %v", err)
+	}
+	return id
+}
+
+// request sends a request through the site's handler with the cookies
+func request(h http.Handler, method, target string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+	r := httptest.NewRequest(method, target, body)
+	if form != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// enableTestTOTP turns on two-factor authentication for the user and
+// returns the secret
+func enableTestTOTP(t *testing.T, user User) string {
+	t.Helper()
+	secret, err := startTOTPEnrollment(user.ID)
+	if err != nil {
+		t.Fatalf("startTOTPEnrollment: %v", err)
+	}
+	code, err := totpCode(secret, uint64(time.Now().Unix()/int64(totpPeriod/time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enableTOTP(user.ID, code); err != nil {
+		t.Fatalf("enableTOTP: %v", err)
+	}
+	return secret
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// releaseDateFormat is the layout movie release dates are entered in
+const releaseDateFormat = "2006-01-02"
+
+// ageRatings are offered as suggestions in the admin form. Other ratings,
+// such as local classifications, are accepted too.
+var ageRatings = []string{"G", "PG", "PG-13", "R", "NC-17"}
+
+// movieColumns are the movies table columns read by scanMovie, in order
+const movieColumns = `id, title, starts_at, runtime, image, price_minor, currency, auditorium,
+    genre, age_rating, synopsis, cast_members, director, language, release_date, trailer_url, poster`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMovie reads a row selected with movieColumns
+func scanMovie(row rowScanner, m *Movie) error {
+	return row.Scan(
+		&m.ID, &m.Title, &m.Time, &m.Runtime, &m.Image, &m.Price, &m.Currency, &m.Auditorium,
+		&m.Genre, &m.AgeRating, &m.Synopsis, &m.Cast, &m.Director, &m.Language, &m.ReleaseDate, &m.TrailerURL, &m.Poster,
+	)
+}
+
+// CastList splits the comma-separated cast into names
+func (m Movie) CastList() []string {
+	var names []string
+	for _, name := range strings.Split(m.Cast, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ReleaseYear is the year from the release date, or "" when it isn't set
+func (m Movie) ReleaseYear() string {
+	if t, err := time.Parse(releaseDateFormat, m.ReleaseDate); err == nil {
+		return t.Format("2006")
+	}
+	return ""
+}
+
+// normalizeMovieDetails trims the descriptive fields and checks the release
+// date, trailer link and currency
+func normalizeMovieDetails(m *Movie) error {
+	for _, field := range []*string{&m.Genre, &m.AgeRating, &m.Synopsis, &m.Director, &m.Language, &m.ReleaseDate, &m.TrailerURL} {
+		*field = strings.TrimSpace(*field)
+	}
+	m.Cast = strings.Join(m.CastList(), ", ")
+
+	if m.ReleaseDate != "" {
+		if _, err := time.Parse(releaseDateFormat, m.ReleaseDate); err != nil {
+			return fmt.Errorf("release date must look like 2024-01-31")
+		}
+	}
+	if m.TrailerURL != "" {
+		u, err := url.Parse(m.TrailerURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("trailer must be an http or https link")
+		}
+	}
+	return normalizeCurrency(m)
+}
+
+// movieGenres lists the distinct genres in the programme for the search filter
+func movieGenres() []string {
+	rows, err := db.Query("SELECT DISTINCT genre FROM movies WHERE genre != '' ORDER BY genre")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var genres []string
+	for rows.Next() {
+		var g string
+		if rows.Scan(&g) == nil {
+			genres = append(genres, g)
+		}
+	}
+	return genres
+}
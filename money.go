@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in the minor unit of its currency, such as cents for
+// USD or yen for JPY. Amounts are whole numbers so that totals add up
+// exactly; the currency is kept alongside, as it is in the database.
+type Money int64
+
+var errInvalidPrice = errors.New("price must be an amount in the movie's currency")
+
+// Scale is how many minor units make up one major unit, e.g. 100 for USD
+func (c Currency) Scale() int64 {
+	scale := int64(1)
+	for i := 0; i < c.Digits; i++ {
+		scale *= 10
+	}
+	return scale
+}
+
+// Step is the smallest amount in the currency as a decimal, e.g. "0.01",
+// for the step of number inputs
+func (c Currency) Step() string {
+	return Money(1).Decimal(c.Code)
+}
+
+// Times is the amount multiplied by a count, e.g. the price of n seats
+func (m Money) Times(n int) Money {
+	return m * Money(n)
+}
+
+// Div splits the amount n ways, rounding half away from zero. It is used for
+// averages; the parts don't add back up to the whole.
+func (m Money) Div(n int) Money {
+	if n == 0 {
+		return 0
+	}
+	q, r := m/Money(n), m%Money(n)
+	if r < 0 {
+		r = -r
+	}
+	if 2*int64(r) >= int64(n) {
+		if m < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+// Decimal shows the amount as a plain decimal in the currency's major unit,
+// e.g. "12.50", for form fields and CSV exports
+func (m Money) Decimal(currency string) string {
+	c := currencyFor(currency)
+	sign := ""
+	minor := int64(m)
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	if c.Digits == 0 {
+		return sign + strconv.FormatInt(minor, 10)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/c.Scale(), c.Digits, minor%c.Scale())
+}
+
+// parseMoney reads a decimal amount in the currency's major unit, such as
+// "12.5" or "12.50", without going through floating point
+func parseMoney(s, currency string) (Money, error) {
+	c := currencyFor(currency)
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, errors.New("amount is empty")
+	}
+	if len(frac) > c.Digits || (hasFrac && frac == "") {
+		return 0, fmt.Errorf("%s amounts have at most %d decimal places", c.Code, c.Digits)
+	}
+	frac += strings.Repeat("0", c.Digits-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+
+	for _, part := range []string{whole, frac} {
+		if strings.Trim(part, "0123456789") != "" {
+			return 0, fmt.Errorf("%q is not an amount", s)
+		}
+	}
+	major, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || major > math.MaxInt64/c.Scale()-1 {
+		return 0, fmt.Errorf("%q is too large", s)
+	}
+	minor := major * c.Scale()
+	if frac != "" {
+		f, _ := strconv.ParseInt(frac, 10, 64)
+		minor += f
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money(minor), nil
+}
+
+// migrateMoney converts prices and totals stored as REAL amounts in the
+// major unit to whole minor units, then drops the REAL columns
+func migrateMoney() error {
+	columns := []struct {
+		table, from, to string
+	}{
+		{"movies", "price", "price_minor"},
+		{"bookings", "total", "total_minor"},
+		{"pos_shifts", "opening_float", "opening_float_minor"},
+		{"pos_shifts", "counted_cash", "counted_cash_minor"},
+	}
+
+	for _, col := range columns {
+		exists, err := columnExists(col.table, col.from)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		if err := convertMoneyColumn(col.table, col.from, col.to); err != nil {
+			return fmt.Errorf("converting %s.%s: %w", col.table, col.from, err)
+		}
+	}
+	return nil
+}
+
+// convertMoneyColumn fills the minor-unit column from the REAL one, using
+// the scale of each row's currency, and drops the REAL column
+func convertMoneyColumn(table, from, to string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT DISTINCT currency FROM %s", table))
+	if err != nil {
+		return err
+	}
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			rows.Close()
+			return err
+		}
+		codes = append(codes, code)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		_, err := tx.Exec(
+			fmt.Sprintf("UPDATE %s SET %s = CAST(ROUND(%s * ?) AS INTEGER) WHERE currency = ?", table, to, from),
+			currencyFor(code).Scale(), code,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, from)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,177 @@
+package main
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in, currency string
+		want         Money
+		ok           bool
+	}{
+		{"12.50", "USD", 1250, true},
+		{"12.5", "USD", 1250, true},
+		{"12", "USD", 1200, true},
+		{".99", "USD", 99, true},
+		{" 7.05 ", "EUR", 705, true},
+		{"-3.25", "USD", -325, true},
+		{"0", "USD", 0, true},
+		{"12.345", "USD", 0, false},
+		{"12.", "USD", 0, false},
+		{"", "USD", 0, false},
+		{"-", "USD", 0, false},
+		{"1,50", "USD", 0, false},
+		{"12.5a", "USD", 0, false},
+		{"1e3", "USD", 0, false},
+		{"+5", "USD", 0, false},
+		{"99999999999999999999", "USD", 0, false},
+
+		// Zero-decimal currencies take whole amounts only
+		{"1500", "JPY", 1500, true},
+		{"-1500", "JPY", -1500, true},
+		{"1500.5", "JPY", 0, false},
+		{"1500.", "JPY", 0, false},
+
+		// Three-decimal currencies count in thousandths
+		{"1.234", "KWD", 1234, true},
+		{"1.2", "KWD", 1200, true},
+		{"-0.005", "KWD", -5, true},
+		{"1.2345", "KWD", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseMoney(tt.in, tt.currency)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseMoney(%q, %s) error = %v, want ok = %v", tt.in, tt.currency, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseMoney(%q, %s) = %d, want %d", tt.in, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		m        Money
+		currency string
+		want     string
+	}{
+		{1250, "USD", "12.50"},
+		{5, "USD", "0.05"},
+		{-325, "USD", "-3.25"},
+		{1500, "JPY", "1500"},
+		{1234, "KWD", "1.234"},
+		{-5, "KWD", "-0.005"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Decimal(tt.currency); got != tt.want {
+			t.Errorf("Money(%d).Decimal(%s) = %q, want %q", tt.m, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyDiv(t *testing.T) {
+	tests := []struct {
+		m    Money
+		n    int
+		want Money
+	}{
+		{1000, 4, 250},
+		{1000, 3, 333}, // 333.33 rounds down
+		{2000, 3, 667}, // 666.67 rounds up
+		{5, 2, 3},      // halves round away from zero
+		{7, 2, 4},      // 3.5
+		{-5, 2, -3},    // -2.5
+		{-1000, 3, -333},
+		{-2000, 3, -667},
+		{1, 3, 0},
+		{1250, 1, 1250},
+		{1250, 0, 0}, // no tickets, no average
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Div(tt.n); got != tt.want {
+			t.Errorf("Money(%d).Div(%d) = %d, want %d", tt.m, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateMoneyFromReal(t *testing.T) {
+	newTestSite(t)
+
+	// Bring back the REAL columns older versions stored amounts in
+	for _, stmt := range []string{
+		"ALTER TABLE movies ADD COLUMN price REAL",
+		"ALTER TABLE bookings ADD COLUMN total REAL",
+		"DELETE FROM movies",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	legacy := []struct {
+		currency string
+		amount   float64
+		want     Money
+	}{
+		{"USD", 12.5, 1250},
+		{"USD", 19.99, 1999}, // not exact as a float
+		{"USD", 0.1 + 0.2, 30},
+		{"EUR", 8.05, 805},
+		{"JPY", 1500, 1500},
+		{"KWD", 2.345, 2345},
+	}
+	for i, l := range legacy {
+		_, err := db.Exec(
+			"INSERT INTO movies (id, title, starts_at, runtime, price, price_minor, currency) VALUES (?, 'Old', CURRENT_TIMESTAMP, 90, ?, 0, ?)",
+			i+1, l.amount, l.currency,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(
+			"INSERT INTO bookings (id, movie_id, name, email, total, total_minor, currency) VALUES (?, ?, 'Old', 'old@example.com', ?, 0, ?)",
+			i+1, i+1, l.amount*2, l.currency,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := migrateMoney(); err != nil {
+		t.Fatalf("migrateMoney: %v", err)
+	}
+
+	for i, l := range legacy {
+		var price, total Money
+		if err := db.QueryRow("SELECT price_minor FROM movies WHERE id = ?", i+1).Scan(&price); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.QueryRow("SELECT total_minor FROM bookings WHERE id = ?", i+1).Scan(&total); err != nil {
+			t.Fatal(err)
+		}
+		if price != l.want {
+			t.Errorf("%v %s price = %d, want %d", l.amount, l.currency, price, l.want)
+		}
+		if total != l.want*2 {
+			t.Errorf("%v %s total = %d, want %d", l.amount*2, l.currency, total, l.want*2)
+		}
+	}
+
+	for _, col := range []struct{ table, column string }{{"movies", "price"}, {"bookings", "total"}} {
+		exists, err := columnExists(col.table, col.column)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Errorf("%s.%s was not dropped", col.table, col.column)
+		}
+	}
+
+	// Running it again finds nothing left to convert
+	if err := migrateMoney(); err != nil {
+		t.Fatalf("second migrateMoney: %v", err)
+	}
+}
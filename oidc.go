@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const oidcLoginDuration = 10 * time.Minute
+
+// OIDCProviderConfig describes one identity provider in the OIDC config file
+type OIDCProviderConfig struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+}
+
+// OIDCProvider is a discovered identity provider ready to handle logins
+type OIDCProvider struct {
+	ID       string
+	Name     string
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// oidcClaims are the ID token claims used to find or create the local account
+type oidcClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// UserIdentity is an external login linked to a local account
+type UserIdentity struct {
+	Provider   string
+	Email      string
+	DateLinked time.Time
+}
+
+var oidcProviders = map[string]*OIDCProvider{}
+
+// loadOIDCConfig reads provider definitions from the JSON file named by
+// MOOBEE_OIDC_CONFIG. A missing file simply means SSO is not configured.
+func loadOIDCConfig() ([]OIDCProviderConfig, error) {
+	path := envOr("MOOBEE_OIDC_CONFIG", "oidc.json")
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []OIDCProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// initOIDC discovers every configured provider. Providers that cannot be
+// reached are logged and left out so password login keeps working.
+func initOIDC(ctx context.Context) {
+	configs, err := loadOIDCConfig()
+	if err != nil {
+		log.Printf("Warning: OIDC login disabled: %v", err)
+		return
+	}
+
+	for _, cfg := range configs {
+		provider, err := newOIDCProvider(ctx, cfg)
+		if err != nil {
+			log.Printf("Warning: skipping OIDC provider %q: %v", cfg.ID, err)
+			continue
+		}
+		oidcProviders[provider.ID] = provider
+		log.Printf("Enabled OIDC login with %s", provider.Name)
+	}
+}
+
+// newOIDCProvider runs discovery against the issuer and builds the OAuth2 client
+func newOIDCProvider(ctx context.Context, cfg OIDCProviderConfig) (*OIDCProvider, error) {
+	if cfg.ID == "" || cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, errors.New("id, issuer and client_id are required")
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+	scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+
+	name := cfg.Name
+	if name == "" {
+		name = cfg.ID
+	}
+
+	return &OIDCProvider{
+		ID:   cfg.ID,
+		Name: name,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  baseURL() + "/auth/oidc/" + cfg.ID + "/callback",
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// loginProviders lists the configured providers for the login page
+func loginProviders() []*OIDCProvider {
+	var list []*OIDCProvider
+	for _, p := range oidcProviders {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// oidcHandler routes /auth/oidc/{provider} and /auth/oidc/{provider}/callback
+func oidcHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path[len("/auth/oidc/"):], "/")
+	id, action, _ := strings.Cut(path, "/")
+
+	provider, ok := oidcProviders[id]
+	if !ok {
+		notFound(w, r)
+		return
+	}
+
+	switch action {
+	case "":
+		oidcStartHandler(w, r, provider)
+	case "callback":
+		oidcCallbackHandler(w, r, provider)
+	default:
+		notFound(w, r)
+	}
+}
+
+// oidcStartHandler redirects the browser to the identity provider
+func oidcStartHandler(w http.ResponseWriter, r *http.Request, provider *OIDCProvider) {
+	state, err := generateToken()
+	if err != nil {
+		serverError(w, r, fmt.Errorf("starting login: %w", err))
+		return
+	}
+	nonce, err := generateToken()
+	if err != nil {
+		serverError(w, r, fmt.Errorf("starting login: %w", err))
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	_, err = db.Exec(
+		"INSERT INTO oidc_logins (state, provider, nonce, verifier, expires_at) VALUES (?, ?, ?, ?, ?)",
+		state, provider.ID, nonce, verifier, time.Now().Add(oidcLoginDuration),
+	)
+	if err != nil {
+		serverError(w, r, fmt.Errorf("starting login: %w", err))
+		return
+	}
+
+	// Bind the state to this browser so a callback can't be replayed elsewhere
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oidc_state",
+		Value:    state,
+		Path:     "/auth/oidc/",
+		Expires:  time.Now().Add(oidcLoginDuration),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authURL := provider.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler completes the authorization-code flow and signs the user in
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request, provider *OIDCProvider) {
+	if errParam := r.URL.Query().Get("error"); errParam != "" {
+		renderLoginError(w, r, "%s login was cancelled or failed", provider.Name)
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	cookie, err := r.Cookie("oidc_state")
+	if err != nil || state == "" || cookie.Value != state {
+		renderLoginError(w, r, "Login session expired, please try again")
+		return
+	}
+
+	// Clear the state cookie, it is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oidc_state",
+		Value:    "",
+		Path:     "/auth/oidc/",
+		Expires:  time.Now().Add(-1 * time.Hour),
+		HttpOnly: true,
+	})
+
+	var nonce, verifier string
+	err = db.QueryRow(
+		"SELECT nonce, verifier FROM oidc_logins WHERE state = ? AND provider = ? AND expires_at > ?",
+		state, provider.ID, time.Now(),
+	).Scan(&nonce, &verifier)
+	if err != nil {
+		renderLoginError(w, r, "Login session expired, please try again")
+		return
+	}
+	db.Exec("DELETE FROM oidc_logins WHERE state = ? OR expires_at <= ?", state, time.Now())
+
+	ctx := r.Context()
+	token, err := provider.oauth.Exchange(ctx, r.URL.Query().Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		log.Printf("OIDC code exchange with %s failed: %v", provider.ID, err)
+		renderLoginError(w, r, "Could not complete login with %s", provider.Name)
+		return
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		renderLoginError(w, r, "Could not complete login with %s", provider.Name)
+		return
+	}
+
+	idToken, err := provider.verifier.Verify(ctx, rawIDToken)
+	if err != nil || idToken.Nonce != nonce {
+		log.Printf("OIDC ID token from %s rejected: %v", provider.ID, err)
+		renderLoginError(w, r, "Could not complete login with %s", provider.Name)
+		return
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		renderLoginError(w, r, "Could not complete login with %s", provider.Name)
+		return
+	}
+
+	// A signed-in user is linking this login to their account
+	current, err := getUserFromSession(r)
+	signedIn := err == nil
+
+	user, err := findOrLinkOIDCUser(r, current, provider.ID, claims)
+	if err != nil {
+		renderLoginError(w, r, err.Error())
+		return
+	}
+	if user.Disabled {
+		renderLoginError(w, r, errAccountDisabled.Error())
+		return
+	}
+	if signedIn && user.ID == current.ID {
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	// Accounts with 2FA still need the second step
+	sessionToken, err := createSession(user.ID, user.TOTPEnabled)
+	if err != nil {
+		serverError(w, r, fmt.Errorf("creating session: %w", err))
+		return
+	}
+
+	if user.TOTPEnabled {
+		setSessionCookie(w, sessionToken, mfaPendingDuration)
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	setSessionCookie(w, sessionToken, sessionDuration)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+var errOIDCSignInToLink = errors.New("an account with this email already exists, sign in with your password and link this login from your profile")
+
+// findOrLinkOIDCUser returns the local account for an identity. Unknown
+// identities are linked to the signed-in user, if there is one, or else to an
+// existing customer account with the same verified email. Admin and staff
+// accounts are only linked by signing in to them first. An email without an
+// account gets a new one.
+func findOrLinkOIDCUser(r *http.Request, current User, providerID string, claims oidcClaims) (User, error) {
+	if claims.Subject == "" {
+		return User{}, errors.New("identity provider did not return a subject")
+	}
+
+	var userID int
+	err := db.QueryRow(
+		"SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?",
+		providerID, claims.Subject,
+	).Scan(&userID)
+	if err == nil {
+		return getUser(userID)
+	}
+	if err != sql.ErrNoRows {
+		return User{}, err
+	}
+
+	if current.ID != 0 {
+		userID = current.ID
+	} else {
+		if claims.Email == "" || !claims.EmailVerified {
+			return User{}, errors.New("your identity provider did not supply a verified email address")
+		}
+
+		var privileged bool
+		err = db.QueryRow("SELECT id, is_admin OR is_staff FROM users WHERE email = ?", claims.Email).Scan(&userID, &privileged)
+		if err == sql.ErrNoRows {
+			userID, err = createOIDCUser(claims)
+		} else if err == nil && privileged {
+			return User{}, errOIDCSignInToLink
+		}
+		if err != nil {
+			return User{}, err
+		}
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO user_identities (user_id, provider, subject, email) VALUES (?, ?, ?, ?)",
+		userID, providerID, claims.Subject, claims.Email,
+	)
+	if err != nil {
+		return User{}, err
+	}
+
+	user, err := getUser(userID)
+	if err != nil {
+		return User{}, err
+	}
+	recordAudit(r, user, "user.identity_link", "user", userID, nil, map[string]string{
+		"provider": providerID,
+		"subject":  claims.Subject,
+		"email":    claims.Email,
+	})
+	return user, nil
+}
+
+// createOIDCUser creates an account for a new SSO user. The random password
+// can never be typed, so the account is SSO-only until the user resets it.
+func createOIDCUser(claims oidcClaims) (int, error) {
+	name := claims.Name
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	password, err := generateToken()
+	if err != nil {
+		return 0, err
+	}
+
+	return registerUser(name, claims.Email, password)
+}
+
+// renderLoginError shows the login page with an error message. The message
+// is a catalog key, translated here so it can take arguments.
+func renderLoginError(w http.ResponseWriter, r *http.Request, message string, args ...interface{}) {
+	data := struct {
+		Error     string
+		Providers []*OIDCProvider
+	}{
+		Error:     requestLocale(r).T(message, args...),
+		Providers: loginProviders(),
+	}
+
+	w.WriteHeader(http.StatusUnauthorized)
+	if err := templates.Render(w, r, "login", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// getUserIdentities lists the external logins linked to the user
+func getUserIdentities(userID int) []UserIdentity {
+	rows, err := db.Query(
+		"SELECT provider, email, date_linked FROM user_identities WHERE user_id = ? ORDER BY date_linked",
+		userID,
+	)
+	if err != nil {
+		log.Printf("Error loading identities for user %d: %v", userID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	var identities []UserIdentity
+	for rows.Next() {
+		var identity UserIdentity
+		if err := rows.Scan(&identity.Provider, &identity.Email, &identity.DateLinked); err != nil {
+			log.Printf("Error scanning identity row: %v", err)
+			continue
+		}
+		if p, ok := oidcProviders[identity.Provider]; ok {
+			identity.Provider = p.Name
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIdP is a stand-in OpenID Connect provider. It serves discovery, its
+// signing key and a token endpoint that checks the PKCE verifier, and signs
+// ID tokens with whatever claims the test authorizes.
+type fakeIdP struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]fakeGrant // by authorization code
+	// nonce, when set, replaces the nonce the client asked for
+	nonce string
+}
+
+type fakeGrant struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+	claims      map[string]interface{}
+}
+
+const (
+	testOIDCClientID     = "moobee"
+	testOIDCClientSecret = "client-secret"
+)
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{t: t, key: key, grants: map[string]fakeGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/keys", idp.keys)
+	mux.HandleFunc("/token", idp.token)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+func (idp *fakeIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                idp.srv.URL,
+		"authorization_endpoint":                idp.srv.URL + "/authorize",
+		"token_endpoint":                        idp.srv.URL + "/token",
+		"jwks_uri":                              idp.srv.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (idp *fakeIdP) keys(w http.ResponseWriter, r *http.Request) {
+	pub := idp.key.PublicKey
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// token exchanges an authorization code, once, for a signed ID token
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(code string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != testOIDCClientID || secret != testOIDCClientSecret {
+		tokenError("invalid_client")
+		return
+	}
+
+	idp.mu.Lock()
+	grant, found := idp.grants[r.PostFormValue("code")]
+	delete(idp.grants, r.PostFormValue("code"))
+	nonce := idp.nonce
+	idp.mu.Unlock()
+	if !found || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != grant.redirectURI {
+		tokenError("invalid_grant")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		tokenError("invalid_grant")
+		return
+	}
+
+	if nonce == "" {
+		nonce = grant.nonce
+	}
+	claims := map[string]interface{}{
+		"iss":   idp.srv.URL,
+		"aud":   testOIDCClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idp.sign(claims),
+	})
+}
+
+// sign makes an RS256 JWT of the claims
+func (idp *fakeIdP) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// authorize plays the user signing in at the provider: it checks the
+// authorization request the site redirected to and returns a code for the claims
+func (idp *fakeIdP) authorize(t *testing.T, location string, claims map[string]interface{}) string {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, idp.srv.URL+"/authorize?") {
+		t.Fatalf("login redirected to %q, want the provider's authorization endpoint", location)
+	}
+	q := u.Query()
+	if q.Get("client_id") != testOIDCClientID || q.Get("response_type") != "code" {
+		t.Fatalf("unexpected authorization request %s", u.RawQuery)
+	}
+	if !strings.Contains(" "+q.Get("scope")+" ", " openid ") {
+		t.Errorf("scope %q is missing openid", q.Get("scope"))
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Errorf("authorization request has no S256 PKCE challenge: %s", u.RawQuery)
+	}
+	if q.Get("state") == "" || q.Get("nonce") == "" {
+		t.Errorf("authorization request has no state or nonce: %s", u.RawQuery)
+	}
+
+	code, err := generateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mu.Lock()
+	idp.grants[code] = fakeGrant{
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		redirectURI: q.Get("redirect_uri"),
+		claims:      claims,
+	}
+	idp.mu.Unlock()
+	return code
+}
+
+// newOIDCTestSite starts the site with the stand-in provider configured as "test"
+func newOIDCTestSite(t *testing.T) (http.Handler, *fakeIdP) {
+	site := newTestSite(t)
+	createTestUser(t, "admin@example.com", true, false)
+
+	idp := newFakeIdP(t)
+	provider, err := newOIDCProvider(context.Background(), OIDCProviderConfig{
+		ID:           "test",
+		Name:         "Test ID",
+		Issuer:       idp.srv.URL,
+		ClientID:     testOIDCClientID,
+		ClientSecret: testOIDCClientSecret,
+	})
+	if err != nil {
+		t.Fatalf("newOIDCProvider: %v", err)
+	}
+	oidcProviders["test"] = provider
+	return site, idp
+}
+
+// startOIDCLogin begins a login and returns the provider URL the browser is
+// sent to, its state and the state cookie
+func startOIDCLogin(t *testing.T, site http.Handler) (string, string, *http.Cookie) {
+	t.Helper()
+	w := request(site, "GET", "/auth/oidc/test", nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("starting login: status %d", w.Code)
+	}
+	location := w.Header().Get("Location")
+	u, _ := url.Parse(location)
+	return location, u.Query().Get("state"), responseCookie(w, "oidc_state")
+}
+
+// oidcCallback returns to the site from the provider
+func oidcCallback(site http.Handler, state, code string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	q := url.Values{"state": {state}, "code": {code}}
+	return request(site, "GET", "/auth/oidc/test/callback?"+q.Encode(), nil, cookies...)
+}
+
+// oidcLogin runs the whole flow for the claims and returns the callback response
+func oidcLogin(t *testing.T, site http.Handler, idp *fakeIdP, claims map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	location, state, cookie := startOIDCLogin(t, site)
+	return oidcCallback(site, state, idp.authorize(t, location, claims), cookie)
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// signedInUser returns the user the response signed in, if any
+func signedInUser(w *httptest.ResponseRecorder) (User, bool) {
+	cookie := responseCookie(w, "session")
+	if cookie == nil || cookie.Value == "" {
+		return User{}, false
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	user, err := getUserFromSession(r)
+	return user, err == nil
+}
+
+func TestOIDCLinksAccountByVerifiedEmail(t *testing.T) {
+	site, idp := newOIDCTestSite(t)
+	existing := createTestUser(t, "film@example.com", false, false)
+
+	w := oidcLogin(t, site, idp, map[string]interface{}{
+		"sub": "user-1", "email": "film@example.com", "email_verified": true, "name": "Film Fan",
+	})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+		t.Fatalf("callback: status %d to %q, want a redirect to /", w.Code, w.Header().Get("Location"))
+	}
+	if user, ok := signedInUser(w); !ok || user.ID != existing.ID {
+		t.Fatalf("signed in as %+v (%v), want the existing account %d", user, ok, existing.ID)
+	}
+	var linked int
+	db.QueryRow("SELECT user_id FROM user_identities WHERE provider = 'test' AND subject = 'user-1'").Scan(&linked)
+	if linked != existing.ID {
+		t.Errorf("identity linked to user %d, want %d", linked, existing.ID)
+	}
+
+	// Once linked, the subject decides, even if the email changes upstream
+	w = oidcLogin(t, site, idp, map[string]interface{}{
+		"sub": "user-1", "email": "renamed@example.com", "email_verified": true,
+	})
+	if user, ok := signedInUser(w); !ok || user.ID != existing.ID {
+		t.Errorf("second login signed in as %+v (%v), want user %d", user, ok, existing.ID)
+	}
+
+	// A verified email without an account gets a new one
+	w = oidcLogin(t, site, idp, map[string]interface{}{
+		"sub": "user-2", "email": "new@example.com", "email_verified": true, "name": "New Fan",
+	})
+	user, ok := signedInUser(w)
+	if !ok || user.Email != "new@example.com" || user.Name != "New Fan" {
+		t.Errorf("new identity signed in as %+v (%v), want a new account for new@example.com", user, ok)
+	}
+}
+
+func TestOIDCRejectsUnverifiedEmail(t *testing.T) {
+	site, idp := newOIDCTestSite(t)
+	createTestUser(t, "film@example.com", false, false)
+
+	for _, claims := range []map[string]interface{}{
+		{"sub": "attacker", "email": "film@example.com", "email_verified": false},
+		{"sub": "attacker", "email": "film@example.com"},
+		{"sub": "attacker", "email": "someone-new@example.com", "email_verified": false},
+		{"sub": "attacker", "email_verified": true},
+	} {
+		w := oidcLogin(t, site, idp, claims)
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "verified email") {
+			t.Errorf("%v: status %d, want 401 asking for a verified email", claims, w.Code)
+		}
+		if _, ok := signedInUser(w); ok {
+			t.Errorf("%v: signed in", claims)
+		}
+	}
+
+	var identities, users int
+	db.QueryRow("SELECT COUNT(*) FROM user_identities").Scan(&identities)
+	db.QueryRow("SELECT COUNT(*) FROM users WHERE email = 'someone-new@example.com'").Scan(&users)
+	if identities != 0 || users != 0 {
+		t.Errorf("unverified logins left %d identities and %d new accounts", identities, users)
+	}
+}
+
+func TestOIDCCallbackChecksState(t *testing.T) {
+	site, idp := newOIDCTestSite(t)
+	claims := map[string]interface{}{"sub": "user-1", "email": "film@example.com", "email_verified": true}
+	expired := func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusUnauthorized && strings.Contains(w.Body.String(), "Login session expired")
+	}
+
+	// The state has to come back to the browser that started the login
+	location, state, cookie := startOIDCLogin(t, site)
+	code := idp.authorize(t, location, claims)
+	if w := oidcCallback(site, state, code); !expired(w) {
+		t.Errorf("without the state cookie: status %d", w.Code)
+	}
+	_, _, other := startOIDCLogin(t, site)
+	if w := oidcCallback(site, state, code, other); !expired(w) {
+		t.Errorf("with another login's state cookie: status %d", w.Code)
+	}
+	if w := oidcCallback(site, "", code, &http.Cookie{Name: "oidc_state", Value: ""}); !expired(w) {
+		t.Errorf("with an empty state: status %d", w.Code)
+	}
+
+	// The real callback works once
+	if w := oidcCallback(site, state, code, cookie); w.Code != http.StatusSeeOther {
+		t.Fatalf("valid callback: status %d", w.Code)
+	}
+	if w := oidcCallback(site, state, code, cookie); !expired(w) {
+		t.Errorf("replayed callback: status %d", w.Code)
+	}
+
+	// Logins left too long expire
+	location, state, cookie = startOIDCLogin(t, site)
+	code = idp.authorize(t, location, claims)
+	db.Exec("UPDATE oidc_logins SET expires_at = ? WHERE state = ?", time.Now().Add(-time.Minute), state)
+	if w := oidcCallback(site, state, code, cookie); !expired(w) {
+		t.Errorf("expired login: status %d", w.Code)
+	}
+
+	// The provider reporting an error is shown, not signed in
+	w := request(site, "GET", "/auth/oidc/test/callback?error=access_denied&state="+state, nil, cookie)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "cancelled or failed") {
+		t.Errorf("provider error: status %d", w.Code)
+	}
+}
+
+func TestOIDCCallbackChecksPKCEAndNonce(t *testing.T) {
+	site, idp := newOIDCTestSite(t)
+	claims := map[string]interface{}{"sub": "user-1", "email": "film@example.com", "email_verified": true}
+	failed := func(w *httptest.ResponseRecorder) bool {
+		_, signedIn := signedInUser(w)
+		return !signedIn && w.Code == http.StatusUnauthorized && strings.Contains(w.Body.String(), "Could not complete login")
+	}
+
+	// A code redeemed with another verifier than the one it was issued for
+	location, state, cookie := startOIDCLogin(t, site)
+	code := idp.authorize(t, location, claims)
+	db.Exec("UPDATE oidc_logins SET verifier = ? WHERE state = ?", strings.Repeat("x", 43), state)
+	if w := oidcCallback(site, state, code, cookie); !failed(w) {
+		t.Errorf("wrong PKCE verifier: status %d", w.Code)
+	}
+
+	// A code that was never issued
+	_, state, cookie = startOIDCLogin(t, site)
+	if w := oidcCallback(site, state, "made-up", cookie); !failed(w) {
+		t.Errorf("unknown code: status %d", w.Code)
+	}
+
+	// An ID token minted for another login
+	idp.nonce = "someone-elses-nonce"
+	if w := oidcLogin(t, site, idp, claims); !failed(w) {
+		t.Errorf("wrong nonce: status %d", w.Code)
+	}
+	idp.nonce = ""
+
+	if w := oidcLogin(t, site, idp, claims); w.Code != http.StatusSeeOther {
+		t.Errorf("valid login after the failures: status %d", w.Code)
+	}
+}
+
+func TestOIDCHandsOffToTwoFactor(t *testing.T) {
+	site, idp := newOIDCTestSite(t)
+	user := createTestUser(t, "film@example.com", false, false)
+	secret := enableTestTOTP(t, user)
+
+	w := oidcLogin(t, site, idp, map[string]interface{}{
+		"sub": "user-1", "email": "film@example.com", "email_verified": true,
+	})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login/2fa" {
+		t.Fatalf("callback: status %d to %q, want a redirect to /login/2fa", w.Code, w.Header().Get("Location"))
+	}
+	if _, ok := signedInUser(w); ok {
+		t.Fatal("signed in before the second factor")
+	}
+	pending := responseCookie(w, "session")
+
+	w = request(site, "GET", "/login/2fa", nil, pending)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "film@example.com") {
+		t.Fatalf("2FA page: status %d", w.Code)
+	}
+
+	w = request(site, "POST", "/login/2fa", url.Values{"code": {lastStepCode(t, user, secret, 1)}}, pending)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+		t.Fatalf("2FA code: status %d to %q, want a redirect to /", w.Code, w.Header().Get("Location"))
+	}
+	if signedIn, ok := signedInUser(w); !ok || signedIn.ID != user.ID {
+		t.Errorf("after 2FA signed in as %+v (%v), want user %d", signedIn, ok, user.ID)
+	}
+}
+
+func TestOIDCLinksPrivilegedAccountsOnlyWhenSignedIn(t *testing.T) {
+	site, idp := newOIDCTestSite(t)
+	var adminID int
+	if err := db.QueryRow("SELECT id FROM users WHERE email = 'admin@example.com'").Scan(&adminID); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := getUser(adminID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staff := createTestUser(t, "staff@example.com", false, true)
+	claims := map[string]interface{}{"sub": "admin-1", "email": admin.Email, "email_verified": true}
+
+	for _, email := range []string{admin.Email, staff.Email} {
+		w := oidcLogin(t, site, idp, map[string]interface{}{"sub": "takeover", "email": email, "email_verified": true})
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "sign in with your password") {
+			t.Errorf("%s: status %d, want 401 asking to sign in first", email, w.Code)
+		}
+		if _, ok := signedInUser(w); ok {
+			t.Errorf("%s: signed in by email alone", email)
+		}
+	}
+
+	// Signed in, the admin links the login from their profile
+	location, state, cookie := startOIDCLogin(t, site)
+	w := oidcCallback(site, state, idp.authorize(t, location, claims), cookie, sessionCookie(t, admin))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/profile" {
+		t.Fatalf("linking: status %d to %q, want a redirect to /profile", w.Code, w.Header().Get("Location"))
+	}
+
+	var linked int
+	db.QueryRow("SELECT user_id FROM user_identities WHERE provider = 'test' AND subject = 'admin-1'").Scan(&linked)
+	if linked != admin.ID {
+		t.Fatalf("identity linked to user %d, want %d", linked, admin.ID)
+	}
+	var after string
+	if err := db.QueryRow("SELECT after FROM audit_log WHERE action = 'user.identity_link' AND target_id = ?", admin.ID).Scan(&after); err != nil {
+		t.Fatalf("no audit entry for the link: %v", err)
+	}
+	if !strings.Contains(after, `"subject":"admin-1"`) {
+		t.Errorf("audit entry after = %s", after)
+	}
+
+	// From then on the login works on its own
+	w = oidcLogin(t, site, idp, claims)
+	if user, ok := signedInUser(w); !ok || user.ID != admin.ID {
+		t.Errorf("linked login signed in as %+v (%v), want user %d", user, ok, admin.ID)
+	}
+}
+
+func TestOIDCLoginErrorsAreTranslated(t *testing.T) {
+	site, _ := newOIDCTestSite(t)
+	_, state, cookie := startOIDCLogin(t, site)
+
+	r := httptest.NewRequest("GET", "/auth/oidc/test/callback?error=access_denied&state="+state, nil)
+	r.Header.Set("Accept-Language", "de")
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	site.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "Die Anmeldung mit Test ID wurde abgebrochen") {
+		t.Errorf("status %d, want the German error naming the provider:\n%s", w.Code, w.Body)
+	}
+}
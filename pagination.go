@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Pagination describes one page of a longer list for the admin templates
+type Pagination struct {
+	Page    int
+	PerPage int
+	Total   int
+	query   url.Values
+}
+
+// newPagination reads the page number from the request's "page" parameter
+func newPagination(r *http.Request, perPage int) Pagination {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	return Pagination{Page: page, PerPage: perPage, query: r.URL.Query()}
+}
+
+// Offset is the number of rows to skip for the current page
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// Pages is the total number of pages, at least one
+func (p Pagination) Pages() int {
+	if p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.PerPage - 1) / p.PerPage
+}
+
+func (p Pagination) HasPrev() bool { return p.Page > 1 }
+func (p Pagination) HasNext() bool { return p.Page < p.Pages() }
+
+// PrevURL and NextURL keep the current filters and only change the page
+func (p Pagination) PrevURL() string { return p.pageURL(p.Page - 1) }
+func (p Pagination) NextURL() string { return p.pageURL(p.Page + 1) }
+
+func (p Pagination) pageURL(page int) string {
+	q := url.Values{}
+	for k, v := range p.query {
+		q[k] = v
+	}
+	q.Set("page", strconv.Itoa(page))
+	return "?" + q.Encode()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// legacyDefaultImage was stored for movies without an upload before
+// placeholders were generated. The file never existed.
+const legacyDefaultImage = "/static/images/default.jpg"
+
+const (
+	// Placeholders use the 2:3 aspect ratio of a one-sheet poster
+	placeholderWidth  = 400
+	placeholderHeight = 600
+
+	placeholderLineChars = 14
+	placeholderMaxLines  = 5
+	placeholderMaxTitle  = 120
+	// placeholderCacheSize bounds the cache, as anyone can ask for any title
+	placeholderCacheSize = 1000
+)
+
+// placeholderCache keeps rendered placeholders by title
+var placeholderCache = struct {
+	sync.Mutex
+	posters map[string][]byte
+}{posters: make(map[string][]byte)}
+
+// placeholderURL is the generated poster for a movie without an image
+func placeholderURL(title string) string {
+	return "/posters/placeholder.svg?title=" + url.QueryEscape(title)
+}
+
+// placeholderPoster returns the SVG placeholder for the title, rendering it
+// the first time it is asked for
+func placeholderPoster(title string) []byte {
+	placeholderCache.Lock()
+	defer placeholderCache.Unlock()
+
+	if svg, ok := placeholderCache.posters[title]; ok {
+		return svg
+	}
+	if len(placeholderCache.posters) >= placeholderCacheSize {
+		placeholderCache.posters = make(map[string][]byte)
+	}
+	svg := renderPlaceholder(title)
+	placeholderCache.posters[title] = svg
+	return svg
+}
+
+// renderPlaceholder draws the title over a gradient whose hue is derived from
+// the title, so each movie keeps the same colour
+func renderPlaceholder(title string) []byte {
+	h := fnv.New32a()
+	h.Write([]byte(title))
+	hue := h.Sum32() % 360
+
+	lines := wrapTitle(title)
+	if len(lines) == 0 {
+		lines = []string{"Moobee"}
+	}
+	const lineHeight = 48
+	top := placeholderHeight/2 - (len(lines)-1)*lineHeight/2
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		placeholderWidth, placeholderHeight, placeholderWidth, placeholderHeight)
+	fmt.Fprintf(&b, `<defs><linearGradient id="bg" x1="0" y1="0" x2="0" y2="1">`+
+		`<stop offset="0" stop-color="hsl(%d, 55%%, 42%%)"/><stop offset="1" stop-color="hsl(%d, 60%%, 18%%)"/>`+
+		`</linearGradient></defs>`, hue, (hue+30)%360)
+	b.WriteString(`<rect width="100%" height="100%" fill="url(#bg)"/>`)
+	fmt.Fprintf(&b, `<rect x="20" y="20" width="%d" height="%d" fill="none" stroke="rgba(255,255,255,0.35)" stroke-width="2"/>`,
+		placeholderWidth-40, placeholderHeight-40)
+	b.WriteString(`<g fill="#fff" font-family="Helvetica, Arial, sans-serif" font-size="40" font-weight="bold" text-anchor="middle">`)
+	for i, line := range lines {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" dominant-baseline="middle">`, placeholderWidth/2, top+i*lineHeight)
+		xml.EscapeText(&b, []byte(line))
+		b.WriteString(`</text>`)
+	}
+	b.WriteString(`</g>`)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" fill="rgba(255,255,255,0.6)" font-family="Helvetica, Arial, sans-serif" font-size="18" text-anchor="middle">Moobee</text>`,
+		placeholderWidth/2, placeholderHeight-44)
+	b.WriteString(`</svg>`)
+	return b.Bytes()
+}
+
+// wrapTitle breaks the title into short lines, shortening it with an
+// ellipsis when it doesn't fit
+func wrapTitle(title string) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(title) {
+		if utf8.RuneCountInString(word) > placeholderLineChars {
+			word = string([]rune(word)[:placeholderLineChars-1]) + "…"
+		}
+		switch {
+		case line == "":
+			line = word
+		case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= placeholderLineChars:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	if len(lines) > placeholderMaxLines {
+		lines = lines[:placeholderMaxLines]
+		last := []rune(lines[placeholderMaxLines-1])
+		if len(last) >= placeholderLineChars {
+			last = last[:placeholderLineChars-1]
+		}
+		lines[placeholderMaxLines-1] = string(last) + "…"
+	}
+	return lines
+}
+
+// placeholderHandler serves generated posters for movies without an image
+func placeholderHandler(w http.ResponseWriter, r *http.Request) {
+	title := strings.TrimSpace(r.URL.Query().Get("title"))
+	if utf8.RuneCountInString(title) > placeholderMaxTitle {
+		title = string([]rune(title)[:placeholderMaxTitle])
+	}
+
+	svg := placeholderPoster(title)
+	sum := sha256.Sum256(svg)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("ETag", etag)
+	// The title is user-controlled, so never let the SVG run anything
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(svg)
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Payment methods recorded on bookings
+const (
+	paymentOnline = "online"
+	paymentCash   = "cash"
+	paymentCard   = "card"
+)
+
+// walkInName is used when a box-office customer doesn't give a name
+const walkInName = "Walk-in customer"
+
+var errNoOpenShift = errors.New("open a shift before selling tickets")
+
+// Shift is one staff member's session at the till, from opening the cash
+// drawer to counting it at the end
+type Shift struct {
+	ID           int
+	UserID       int
+	UserName     string
+	OpenedAt     time.Time
+	ClosedAt     *time.Time
+	Currency     string // the drawer's currency; every sale in the shift is in it
+	OpeningFloat Money
+	CountedCash  *Money
+	Note         string
+}
+
+// ShiftSummary totals the sales made during a shift
+type ShiftSummary struct {
+	Shift          Shift
+	Bookings       int
+	Tickets        int
+	CashSales      Money
+	CardSales      Money
+	CancelledCount int
+	CancelledTotal Money
+	Sales          []Booking
+}
+
+// ExpectedCash is what should be in the drawer: the float plus cash sales
+func (s ShiftSummary) ExpectedCash() Money {
+	return s.Shift.OpeningFloat + s.CashSales
+}
+
+// Variance is the counted cash minus the expected cash, once counted
+func (s ShiftSummary) Variance() Money {
+	if s.Shift.CountedCash == nil {
+		return 0
+	}
+	return *s.Shift.CountedCash - s.ExpectedCash()
+}
+
+// TotalSales is the cash and card takings together
+func (s ShiftSummary) TotalSales() Money {
+	return s.CashSales + s.CardSales
+}
+
+// qrDataURL renders content as a PNG QR code data URL for use in templates
+func qrDataURL(content string, size int) (template.URL, error) {
+	png, err := qrcode.Encode(content, qrcode.Medium, size)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)), nil
+}
+
+// getShift loads a shift by ID
+func getShift(id int) (Shift, error) {
+	var s Shift
+	var closedAt sql.NullTime
+	var counted sql.NullInt64
+	err := db.QueryRow(`
+        SELECT p.id, p.user_id, u.name, p.opened_at, p.closed_at, p.currency, p.opening_float_minor, p.counted_cash_minor, p.note
+        FROM pos_shifts p
+        LEFT JOIN users u ON u.id = p.user_id
+        WHERE p.id = ?
+    `, id).Scan(&s.ID, &s.UserID, &s.UserName, &s.OpenedAt, &closedAt, &s.Currency, &s.OpeningFloat, &counted, &s.Note)
+	if err != nil {
+		return s, err
+	}
+	if closedAt.Valid {
+		s.ClosedAt = &closedAt.Time
+	}
+	if counted.Valid {
+		cash := Money(counted.Int64)
+		s.CountedCash = &cash
+	}
+	return s, nil
+}
+
+// openShift returns the user's open shift, or sql.ErrNoRows if they have none
+func openShift(userID int) (Shift, error) {
+	var id int
+	err := db.QueryRow(
+		"SELECT id FROM pos_shifts WHERE user_id = ? AND closed_at IS NULL ORDER BY id DESC LIMIT 1",
+		userID,
+	).Scan(&id)
+	if err != nil {
+		return Shift{}, err
+	}
+	return getShift(id)
+}
+
+// startShift opens the cash drawer for the user with the given float in
+// the currency
+func startShift(userID int, float Money, currency string) (int, error) {
+	if _, err := openShift(userID); err == nil {
+		return 0, errors.New("you already have an open shift")
+	}
+	if float < 0 {
+		return 0, errors.New("the opening float can't be negative")
+	}
+	c, ok := findCurrency(currency)
+	if !ok {
+		return 0, errors.New("choose the drawer's currency")
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO pos_shifts (user_id, currency, opening_float_minor, opened_at) VALUES (?, ?, ?, ?)",
+		userID, c.Code, float, time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// closeShift records the counted cash and ends the shift
+func closeShift(shiftID int, counted Money, note string) error {
+	if counted < 0 {
+		return errors.New("the counted cash can't be negative")
+	}
+	_, err := db.Exec(
+		"UPDATE pos_shifts SET closed_at = ?, counted_cash_minor = ?, note = ? WHERE id = ? AND closed_at IS NULL",
+		time.Now(), counted, note, shiftID,
+	)
+	return err
+}
+
+// summarizeShift totals the bookings sold during the shift
+func summarizeShift(shift Shift) (ShiftSummary, error) {
+	summary := ShiftSummary{Shift: shift}
+
+	rows, err := db.Query(`
+        SELECT id, name, email, movie_id, total_minor, currency, date, status, payment_method
+        FROM bookings
+        WHERE shift_id = ?
+        ORDER BY id
+    `, shift.ID)
+	if err != nil {
+		return summary, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b Booking
+		if err := rows.Scan(&b.ID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Currency, &b.Date, &b.Status, &b.PaymentMethod); err != nil {
+			log.Printf("Error scanning booking row: %v", err)
+			continue
+		}
+		b.Seats = getBookingSeats(b.ID)
+		summary.Sales = append(summary.Sales, b)
+
+		if b.Status != bookingConfirmed {
+			summary.CancelledCount++
+			summary.CancelledTotal += b.Total
+			continue
+		}
+		summary.Bookings++
+		summary.Tickets += len(b.Seats)
+		if b.PaymentMethod == paymentCash {
+			summary.CashSales += b.Total
+		} else {
+			summary.CardSales += b.Total
+		}
+	}
+
+	return summary, rows.Err()
+}
+
+// posHandler is the box-office home: open a shift, pick a screening to sell,
+// and close the shift at the end of the day
+func posHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+
+	var actionError string
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "open":
+			var float Money
+			if value := strings.TrimSpace(r.FormValue("float")); value != "" {
+				var err error
+				if float, err = parseMoney(value, r.FormValue("currency")); err != nil {
+					actionError = "Enter the opening float in the drawer's currency"
+					break
+				}
+			}
+			id, err := startShift(user.ID, float, r.FormValue("currency"))
+			if err != nil {
+				actionError = err.Error()
+				break
+			}
+			recordAudit(r, user, "pos.shift_open", "shift", id, nil, map[string]interface{}{
+				"opening_float": float,
+				"currency":      r.FormValue("currency"),
+			})
+			http.Redirect(w, r, "/pos", http.StatusSeeOther)
+			return
+		case "close":
+			shift, err := openShift(user.ID)
+			if err != nil {
+				actionError = "You don't have an open shift"
+				break
+			}
+			counted, err := parseMoney(r.FormValue("counted"), shift.Currency)
+			if err != nil {
+				actionError = "Enter the cash counted in the drawer"
+				break
+			}
+			if err := closeShift(shift.ID, counted, strings.TrimSpace(r.FormValue("note"))); err != nil {
+				actionError = err.Error()
+				break
+			}
+			closed, _ := getShift(shift.ID)
+			summary, _ := summarizeShift(closed)
+			recordAudit(r, user, "pos.shift_close", "shift", shift.ID, nil, map[string]interface{}{
+				"expected_cash": summary.ExpectedCash(),
+				"counted_cash":  counted,
+				"variance":      summary.Variance(),
+				"currency":      shift.Currency,
+			})
+			http.Redirect(w, r, fmt.Sprintf("/pos/shift/%d", shift.ID), http.StatusSeeOther)
+			return
+		default:
+			httpError(w, r, http.StatusBadRequest, "Unknown action")
+			return
+		}
+	}
+
+	var summary *ShiftSummary
+	if shift, err := openShift(user.ID); err == nil {
+		s, err := summarizeShift(shift)
+		if err != nil {
+			log.Printf("Error summarizing shift %d: %v", shift.ID, err)
+		}
+		summary = &s
+	}
+
+	// Upcoming screenings first
+	mutex.Lock()
+	screenings := append([]Movie{}, movies...)
+	mutex.Unlock()
+	sort.Slice(screenings, func(i, j int) bool { return screenings[i].Time.Before(screenings[j].Time) })
+
+	data := struct {
+		User         User
+		Shift        *ShiftSummary
+		Screenings   []Movie
+		Currencies   []Currency
+		SiteCurrency string
+		Error        string
+	}{
+		User:         user,
+		Shift:        summary,
+		Screenings:   screenings,
+		Currencies:   currencies,
+		SiteCurrency: siteCurrency(),
+		Error:        actionError,
+	}
+
+	err := templates.Render(w, r, "pos", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// posSellHandler sells seats for one screening to a walk-in customer and
+// sends staff straight to the printable tickets
+func posSellHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+
+	id, err := strconv.Atoi(strings.Trim(r.URL.Path[len("/pos/sell/"):], "/"))
+	if err != nil {
+		httpError(w, r, http.StatusBadRequest, "Invalid movie ID")
+		return
+	}
+	movie := getMovie(id)
+	if movie == nil {
+		httpError(w, r, http.StatusNotFound, "Movie not found")
+		return
+	}
+
+	shift, shiftErr := openShift(user.ID)
+
+	var actionError string
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			httpError(w, r, http.StatusBadRequest, "Error parsing form")
+			return
+		}
+
+		seats := r.PostForm["seats"]
+		method := r.PostFormValue("payment")
+		name := strings.TrimSpace(r.PostFormValue("name"))
+		email := strings.TrimSpace(r.PostFormValue("email"))
+		if name == "" {
+			name = walkInName
+		}
+
+		switch {
+		case shiftErr != nil:
+			actionError = errNoOpenShift.Error()
+		case len(seats) == 0:
+			actionError = "Select at least one seat"
+		case method != paymentCash && method != paymentCard:
+			actionError = "Choose how the customer paid"
+		case movie.Currency != shift.Currency:
+			actionError = fmt.Sprintf("This screening is priced in %s but the drawer is in %s", movie.Currency, shift.Currency)
+		default:
+			mutex.Lock()
+			bookingID, err := createBooking(movie, seats, name, email, user, bookingSale{
+				PaymentMethod: method,
+				SoldBy:        user.ID,
+				ShiftID:       shift.ID,
+			})
+			mutex.Unlock()
+
+			if err != nil {
+				var unavailable seatUnavailableError
+				if errors.As(err, &unavailable) {
+					actionError = unavailable.Error()
+				} else {
+					log.Printf("Error selling tickets: %v", err)
+					actionError = "Error creating booking"
+				}
+				break
+			}
+
+			recordAudit(r, user, "booking.sell", "booking", bookingID, nil, map[string]interface{}{
+				"seats":   seats,
+				"payment": method,
+				"shift":   shift.ID,
+			})
+
+			http.Redirect(w, r, fmt.Sprintf("/pos/tickets/%d?tendered=%s", bookingID, url.QueryEscape(r.PostFormValue("tendered"))), http.StatusSeeOther)
+			return
+		}
+	}
+
+	data := struct {
+		User     User
+		Movie    *Movie
+		Notes    map[string]string
+		SellOnly bool
+		HasShift bool
+		Error    string
+		Name     string
+		Email    string
+		WalkIn   string
+	}{
+		User:     user,
+		Movie:    movie,
+		SellOnly: true,
+		HasShift: shiftErr == nil,
+		Error:    actionError,
+		Name:     r.PostFormValue("name"),
+		Email:    r.PostFormValue("email"),
+		WalkIn:   walkInName,
+	}
+
+	err = templates.Render(w, r, "pos_sell", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// Ticket is one printed admission for a seat
+type Ticket struct {
+	Seat string
+	QR   template.URL
+}
+
+// posTicketsHandler shows a booking as printable tickets, one per seat, with
+// the change due for cash payments
+func posTicketsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+
+	id, err := strconv.Atoi(strings.Trim(r.URL.Path[len("/pos/tickets/"):], "/"))
+	if err != nil {
+		httpError(w, r, http.StatusBadRequest, "Invalid booking ID")
+		return
+	}
+
+	var b Booking
+	err = db.QueryRow(
+		"SELECT id, name, email, movie_id, total_minor, currency, date, status, payment_method FROM bookings WHERE id = ?",
+		id,
+	).Scan(&b.ID, &b.Name, &b.Email, &b.MovieID, &b.Total, &b.Currency, &b.Date, &b.Status, &b.PaymentMethod)
+	if err == sql.ErrNoRows {
+		httpError(w, r, http.StatusNotFound, "Booking not found")
+		return
+	} else if err != nil {
+		serverError(w, r, fmt.Errorf("loading booking: %w", err))
+		return
+	}
+	b.Seats = getBookingSeats(b.ID)
+
+	var tickets []Ticket
+	for _, seat := range b.Seats {
+		qr, err := qrDataURL(fmt.Sprintf("MOOBEE-%d-%s", b.ID, seat), 120)
+		if err != nil {
+			log.Printf("Error creating ticket QR code: %v", err)
+		}
+		tickets = append(tickets, Ticket{Seat: seat, QR: qr})
+	}
+
+	// Change is only meaningful straight after a cash sale
+	var tendered, change Money
+	if b.PaymentMethod == paymentCash {
+		tendered, _ = parseMoney(r.URL.Query().Get("tendered"), b.Currency)
+		if tendered >= b.Total {
+			change = tendered - b.Total
+		}
+	}
+
+	data := struct {
+		User     User
+		Booking  Booking
+		Movie    *Movie
+		Tickets  []Ticket
+		Tendered Money
+		Change   Money
+	}{
+		User:     user,
+		Booking:  b,
+		Movie:    getMovie(b.MovieID),
+		Tickets:  tickets,
+		Tendered: tendered,
+		Change:   change,
+	}
+
+	err = templates.Render(w, r, "pos_tickets", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// posShiftHandler shows the end-of-shift summary. Staff can see their own
+// shifts and admins can see everyone's.
+func posShiftHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+
+	id, err := strconv.Atoi(strings.Trim(r.URL.Path[len("/pos/shift/"):], "/"))
+	if err != nil {
+		httpError(w, r, http.StatusBadRequest, "Invalid shift ID")
+		return
+	}
+
+	shift, err := getShift(id)
+	if err == sql.ErrNoRows || (err == nil && shift.UserID != user.ID && !user.IsAdmin) {
+		httpError(w, r, http.StatusNotFound, "Shift not found")
+		return
+	} else if err != nil {
+		serverError(w, r, fmt.Errorf("loading shift: %w", err))
+		return
+	}
+
+	summary, err := summarizeShift(shift)
+	if err != nil {
+		serverError(w, r, fmt.Errorf("loading shift: %w", err))
+		return
+	}
+
+	data := struct {
+		User    User
+		Summary ShiftSummary
+	}{
+		User:    user,
+		Summary: summary,
+	}
+
+	err = templates.Render(w, r, "pos_shift", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
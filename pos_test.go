@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPOSRejectsSaleInAnotherCurrency(t *testing.T) {
+	site := newTestSite(t)
+	createTestUser(t, "admin@example.com", true, false)
+	staff := createTestUser(t, "staff@example.com", false, true)
+	movie := createTestMovie(t, "Dollar Matinee")
+	shiftID, err := startShift(staff.ID, 5000, "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"seats": {seatID(0, 0)}, "payment": {paymentCash}}
+	w := request(site, "POST", "/pos/sell/"+strconv.Itoa(movie.ID), form, sessionCookie(t, staff))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "priced in USD but the drawer is in EUR") {
+		t.Errorf("status %d, want the sale page with a currency error", w.Code)
+	}
+
+	var sold int
+	db.QueryRow("SELECT COUNT(*) FROM bookings WHERE shift_id = ?", shiftID).Scan(&sold)
+	if sold != 0 {
+		t.Errorf("%d bookings were sold in the wrong currency", sold)
+	}
+	if !getMovie(movie.ID).seatAvailable(0, 0, false) {
+		t.Error("the seat was taken")
+	}
+}
+
+func TestShiftSummaryTotals(t *testing.T) {
+	site := newTestSite(t)
+	createTestUser(t, "admin@example.com", true, false)
+	staff := createTestUser(t, "staff@example.com", false, true)
+	cookie := sessionCookie(t, staff)
+	movie := createTestMovie(t, "Box Office Matinee")
+	shiftID, err := startShift(staff.ID, 10000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sell := func(payment string, seats ...string) int {
+		t.Helper()
+		form := url.Values{"seats": seats, "payment": {payment}}
+		w := request(site, "POST", "/pos/sell/"+strconv.Itoa(movie.ID), form, cookie)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("selling %v: status %d", seats, w.Code)
+		}
+		// Redirects to /pos/tickets/{id}
+		id, _ := strconv.Atoi(strings.TrimPrefix(strings.Split(w.Header().Get("Location"), "?")[0], "/pos/tickets/"))
+		return id
+	}
+	sell(paymentCash, seatID(0, 0), seatID(0, 1))
+	sell(paymentCard, seatID(1, 0))
+	refunded := sell(paymentCash, seatID(2, 0))
+	if _, err := cancelBooking(refunded, bookingRefunded); err != nil {
+		t.Fatalf("cancelBooking: %v", err)
+	}
+
+	if err := closeShift(shiftID, 12400, "short 1.00"); err != nil {
+		t.Fatal(err)
+	}
+	shift, err := getShift(shiftID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := summarizeShift(shift)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		name      string
+		got, want Money
+	}{
+		{"cash sales", summary.CashSales, 2500},
+		{"card sales", summary.CardSales, 1250},
+		{"total sales", summary.TotalSales(), 3750},
+		{"cancelled total", summary.CancelledTotal, 1250},
+		{"expected cash", summary.ExpectedCash(), 12500},
+		{"variance", summary.Variance(), -100},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %d, want %d", c.name, c.got, c.want)
+		}
+	}
+	if summary.Bookings != 2 || summary.Tickets != 3 || summary.CancelledCount != 1 || len(summary.Sales) != 3 {
+		t.Errorf("%d bookings, %d tickets, %d cancelled, %d sales; want 2, 3, 1, 3",
+			summary.Bookings, summary.Tickets, summary.CancelledCount, len(summary.Sales))
+	}
+}
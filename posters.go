@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register decoders for accepted uploads
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// maxPosterSize limits uploaded poster files
+	maxPosterSize = 10 << 20
+	// maxPosterPixels guards against small files that decode to huge images
+	maxPosterPixels = 40_000_000
+	// minPosterWidth rejects images too small to show on a movie card
+	minPosterWidth = 200
+
+	posterQuality = 85
+)
+
+// PosterSize is one rendition of an uploaded poster
+type PosterSize struct {
+	Name  string
+	Width int
+}
+
+// posterSizes are generated for every upload, smallest first. Posters are
+// never scaled up, so a small upload may give several identical renditions.
+var posterSizes = []PosterSize{
+	{"thumb", 160},
+	{"card", 400},
+	{"hero", 1200},
+}
+
+// posterTypes are the image formats accepted for upload, by sniffed content type
+var posterTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Poster is an uploaded image resized and re-encoded as JPEG, ready to store
+type Poster struct {
+	Key        string            // content hash shared by the renditions
+	Renditions map[string][]byte // JPEG data by size name
+}
+
+// processPoster checks that the upload is a real image of a sensible size and
+// produces a JPEG in each of the poster sizes
+func processPoster(r io.Reader) (*Poster, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxPosterSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPosterSize {
+		return nil, fmt.Errorf("the poster must be smaller than %d MB", maxPosterSize>>20)
+	}
+
+	// Trust the content, not the filename or the browser's content type
+	if kind := http.DetectContentType(data); !posterTypes[kind] {
+		return nil, errors.New("the poster must be a JPEG, PNG, GIF or WebP image")
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("the poster image could not be read")
+	}
+	if cfg.Width*cfg.Height > maxPosterPixels {
+		return nil, errors.New("the poster image is too large")
+	}
+	if cfg.Width < minPosterWidth {
+		return nil, fmt.Errorf("the poster must be at least %d pixels wide", minPosterWidth)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("the poster image could not be read")
+	}
+
+	sum := sha256.Sum256(data)
+	poster := &Poster{
+		Key:        hex.EncodeToString(sum[:6]),
+		Renditions: make(map[string][]byte),
+	}
+	for _, size := range posterSizes {
+		img := resizeToWidth(src, size.Width)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: posterQuality}); err != nil {
+			return nil, err
+		}
+		poster.Renditions[size.Name] = buf.Bytes()
+	}
+	return poster, nil
+}
+
+// resizeToWidth scales the image down to the width, keeping its aspect ratio,
+// onto a white background so transparent areas don't turn black in JPEG
+func resizeToWidth(src image.Image, width int) image.Image {
+	b := src.Bounds()
+	if b.Dx() < width {
+		width = b.Dx()
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	return dst
+}
+
+// posterName is the file name of one rendition of a movie's poster. The
+// content hash changes the URL whenever the poster is replaced.
+func posterName(movieID int, key, size string) string {
+	return fmt.Sprintf("movie_%d_%s_%s.jpg", movieID, key, size)
+}
+
+// posterKey is the asset store key of a rendition of a stored poster
+func posterKey(poster, size string) string {
+	return "posters/" + strings.Replace(poster, "{size}", size, 1)
+}
+
+// posterURL is where a rendition of a stored poster is served from
+func posterURL(poster, size string) string {
+	return assets.URL(posterKey(poster, size))
+}
+
+// savePoster uploads every rendition for the movie and returns the poster
+// reference stored with it
+func savePoster(ctx context.Context, movieID int, p *Poster) (string, error) {
+	ref := posterName(movieID, p.Key, "{size}")
+	for name, data := range p.Renditions {
+		if err := assets.Put(ctx, posterKey(ref, name), "image/jpeg", data); err != nil {
+			return "", err
+		}
+	}
+	return ref, nil
+}
+
+// removePoster deletes a movie's stored renditions, e.g. after it is replaced
+func removePoster(poster string) {
+	if poster == "" {
+		return
+	}
+	for _, size := range posterSizes {
+		key := posterKey(poster, size.Name)
+		if err := assets.Delete(context.Background(), key); err != nil {
+			log.Printf("Error removing poster %s: %v", key, err)
+		}
+	}
+}
+
+// PosterURL is the movie's poster at the named size, falling back to its
+// image URL for posters that weren't uploaded through the pipeline and to a
+// generated placeholder for movies without any image
+func (m Movie) PosterURL(size string) string {
+	switch {
+	case m.Poster != "":
+		return posterURL(m.Poster, size)
+	case strings.HasPrefix(m.Image, "/static/"):
+		// Bundled images, such as the sample posters, get a cacheable URL
+		return staticURL(strings.TrimPrefix(m.Image, "/static/"))
+	case m.Image != "":
+		return m.Image
+	default:
+		return placeholderURL(m.Title)
+	}
+}
+
+// PosterSrcset lists every rendition for a srcset attribute, or "" when the
+// movie only has a single image
+func (m Movie) PosterSrcset() string {
+	if m.Poster == "" {
+		return ""
+	}
+	var set []string
+	for _, size := range posterSizes {
+		set = append(set, fmt.Sprintf("%s %dw", posterURL(m.Poster, size.Name), size.Width))
+	}
+	return strings.Join(set, ", ")
+}
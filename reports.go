@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const reportDateFormat = "2006-01-02"
+
+// ReportRow is one line of a sales report: a movie, a day or a screening
+type ReportRow struct {
+	Label    string
+	Showtime string
+	Currency string
+	Bookings int
+	Tickets  int
+	Revenue  Money
+	Capacity int
+	Booked   int
+	Bar      int // chart bar length as a percentage of the largest row
+}
+
+// AveragePrice is the revenue per ticket sold
+func (r ReportRow) AveragePrice() Money {
+	return r.Revenue.Div(r.Tickets)
+}
+
+// Occupancy is the percentage of the screening's seats that are booked
+func (r ReportRow) Occupancy() float64 {
+	if r.Capacity == 0 {
+		return 0
+	}
+	return float64(r.Booked) * 100 / float64(r.Capacity)
+}
+
+// CurrencySales is the part of a report charged in one currency. Amounts in
+// different currencies are never added together.
+type CurrencySales struct {
+	Currency string
+	Totals   ReportRow
+	Movies   []ReportRow
+	Days     []ReportRow
+	Refunds  ReportRow // refunds issued in the range, whenever the booking was made
+}
+
+// SalesReport covers confirmed bookings made between From and To inclusive.
+// Refunded bookings no longer count as sales; what was paid back for them is
+// reported under the day of the refund.
+type SalesReport struct {
+	From       string
+	To         string
+	Currencies []*CurrencySales // the site currency first, then by code
+	Showtimes  []ReportRow
+}
+
+// currency returns the section for the currency, adding it if needed
+func (r *SalesReport) currency(code string) *CurrencySales {
+	for _, c := range r.Currencies {
+		if c.Currency == code {
+			return c
+		}
+	}
+	c := &CurrencySales{Currency: code, Totals: ReportRow{Currency: code}}
+	r.Currencies = append(r.Currencies, c)
+	return c
+}
+
+// parseReportRange reads the from/to dates, defaulting to the last 30 days.
+// Days run from midnight to midnight in the cinema's time zone.
+func parseReportRange(r *http.Request) (time.Time, time.Time) {
+	loc := cinemaLocation()
+	to, err := time.ParseInLocation(reportDateFormat, r.URL.Query().Get("to"), loc)
+	if err != nil {
+		now := time.Now().In(loc)
+		to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	}
+	from, err := time.ParseInLocation(reportDateFormat, r.URL.Query().Get("from"), loc)
+	if err != nil {
+		from = to.AddDate(0, 0, -29)
+	}
+	if from.After(to) {
+		from, to = to, from
+	}
+	return from, to
+}
+
+// salesCTE selects the confirmed bookings made between two UTC instants
+// with their ticket counts
+const salesCTE = `
+    WITH sales AS (
+        SELECT b.id, b.movie_id, b.total_minor, b.currency, datetime(b.date) AS sold_at,
+            (SELECT COUNT(*) FROM booking_seats s WHERE s.booking_id = b.id) AS tickets
+        FROM bookings b
+        WHERE b.status = ? AND datetime(b.date) >= datetime(?) AND datetime(b.date) < datetime(?)
+    )
+`
+
+// sqliteUTCFormat is how SQLite's datetime() writes a UTC time
+const sqliteUTCFormat = "2006-01-02 15:04:05"
+
+// buildSalesReport runs the report queries for the days from and to, which
+// are midnights in the cinema's time zone
+func buildSalesReport(from, to time.Time) (SalesReport, error) {
+	loc := cinemaLocation()
+	report := SalesReport{From: from.Format(reportDateFormat), To: to.Format(reportDateFormat)}
+	start := from.UTC().Format(sqliteUTCFormat)
+	end := to.AddDate(0, 0, 1).UTC().Format(sqliteUTCFormat)
+	args := []interface{}{bookingConfirmed, start, end}
+	// The site currency is always shown, even without sales
+	report.currency(siteCurrency())
+
+	rows, err := db.Query(salesCTE+`
+        SELECT currency, COUNT(*), SUM(tickets), SUM(total_minor) FROM sales GROUP BY currency ORDER BY currency
+    `, args...)
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var row ReportRow
+		if err := rows.Scan(&row.Currency, &row.Bookings, &row.Tickets, &row.Revenue); err != nil {
+			log.Printf("Error scanning report row: %v", err)
+			continue
+		}
+		report.currency(row.Currency).Totals = row
+	}
+	rows.Close()
+
+	// Refunds in the currency they were paid back in
+	rows, err = db.Query(`
+        SELECT refund_currency, COUNT(*), SUM(refund_minor) FROM bookings
+        WHERE status = ? AND datetime(refunded_at) >= datetime(?) AND datetime(refunded_at) < datetime(?)
+        GROUP BY refund_currency ORDER BY refund_currency
+    `, bookingRefunded, start, end)
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var row ReportRow
+		if err := rows.Scan(&row.Currency, &row.Bookings, &row.Revenue); err != nil {
+			log.Printf("Error scanning report row: %v", err)
+			continue
+		}
+		report.currency(row.Currency).Refunds = row
+	}
+	rows.Close()
+
+	// Revenue per movie title, across all of its screenings
+	rows, err = db.Query(salesCTE+`
+        SELECT COALESCE(m.title, 'Deleted movie #' || sales.movie_id), sales.currency, COUNT(*), SUM(tickets), SUM(total_minor)
+        FROM sales
+        LEFT JOIN movies m ON m.id = sales.movie_id
+        GROUP BY 1, 2
+        ORDER BY 5 DESC
+    `, args...)
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var row ReportRow
+		if err := rows.Scan(&row.Label, &row.Currency, &row.Bookings, &row.Tickets, &row.Revenue); err != nil {
+			log.Printf("Error scanning report row: %v", err)
+			continue
+		}
+		c := report.currency(row.Currency)
+		c.Movies = append(c.Movies, row)
+	}
+	rows.Close()
+
+	// Revenue per day, with every day of the range present so the chart has
+	// no gaps. Sales are put on their day in the cinema's time zone here, as
+	// SQLite only knows UTC and the server's own zone.
+	byDay := make(map[string]ReportRow)
+	rows, err = db.Query(salesCTE+`
+        SELECT sold_at, currency, tickets, total_minor FROM sales
+    `, args...)
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var soldAt, currency string
+		var tickets int
+		var total Money
+		if err := rows.Scan(&soldAt, &currency, &tickets, &total); err != nil {
+			log.Printf("Error scanning report row: %v", err)
+			continue
+		}
+		at, err := time.Parse(sqliteUTCFormat, soldAt)
+		if err != nil {
+			log.Printf("Error reading sale time %q: %v", soldAt, err)
+			continue
+		}
+		key := currency + " " + at.In(loc).Format(reportDateFormat)
+		row := byDay[key]
+		row.Bookings++
+		row.Tickets += tickets
+		row.Revenue += total
+		byDay[key] = row
+		report.currency(currency)
+	}
+	rows.Close()
+	for _, c := range report.Currencies {
+		for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+			day := d.Format(reportDateFormat)
+			row := byDay[c.Currency+" "+day]
+			row.Label = day
+			row.Currency = c.Currency
+			c.Days = append(c.Days, row)
+		}
+	}
+
+	// Sales and occupancy per screening. Occupancy counts every seat booked
+	// for the screening, not only those sold within the range, out of the
+	// seats that aren't blocked. A screening whose price changed currency
+	// has a row per currency.
+	rows, err = db.Query(salesCTE+`
+        SELECT m.id, m.title, m.starts_at, COALESCE(sales.currency, m.currency),
+            COUNT(sales.id), COALESCE(SUM(sales.tickets), 0), COALESCE(SUM(sales.total_minor), 0),
+            (SELECT COUNT(*) FROM seats WHERE movie_id = m.id),
+            (SELECT COALESCE(SUM(is_booked), 0) FROM seats WHERE movie_id = m.id)
+        FROM movies m
+        LEFT JOIN sales ON sales.movie_id = m.id
+        GROUP BY m.id, 4
+        ORDER BY m.starts_at, m.title
+    `, args...)
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var row ReportRow
+		var movieID int
+		var showtime time.Time
+		if err := rows.Scan(&movieID, &row.Label, &showtime, &row.Currency, &row.Bookings, &row.Tickets, &row.Revenue, &row.Capacity, &row.Booked); err != nil {
+			log.Printf("Error scanning report row: %v", err)
+			continue
+		}
+		row.Showtime = Movie{Time: showtime}.ShowtimeLabel()
+		if movie := getMovie(movieID); movie != nil {
+			for _, kind := range movie.Blocks {
+				if kind == seatBlocked {
+					row.Capacity--
+				}
+			}
+		}
+		report.Showtimes = append(report.Showtimes, row)
+	}
+	rows.Close()
+
+	// The site currency stays first, the rest follow by code
+	sort.SliceStable(report.Currencies[1:], func(i, j int) bool {
+		return report.Currencies[i+1].Currency < report.Currencies[j+1].Currency
+	})
+	for _, c := range report.Currencies {
+		scaleBars(c.Movies)
+		scaleBars(c.Days)
+	}
+	return report, rows.Err()
+}
+
+// scaleBars sets each row's chart bar relative to the highest revenue
+func scaleBars(rows []ReportRow) {
+	var max Money
+	for _, row := range rows {
+		if row.Revenue > max {
+			max = row.Revenue
+		}
+	}
+	if max == 0 {
+		return
+	}
+	for i := range rows {
+		rows[i].Bar = int(rows[i].Revenue * 100 / max)
+	}
+}
+
+// writeReportCSV sends one section of the report as a CSV download, limited
+// to one currency when currency is set
+func writeReportCSV(w http.ResponseWriter, r *http.Request, report SalesReport, section, currency string) {
+	var header []string
+	var rows []ReportRow
+	switch section {
+	case "movies":
+		header = []string{"Movie", "Currency", "Bookings", "Tickets", "Revenue", "Average Ticket Price"}
+		for _, c := range report.Currencies {
+			rows = append(rows, c.Movies...)
+		}
+	case "days":
+		header = []string{"Date", "Currency", "Bookings", "Tickets", "Revenue", "Average Ticket Price"}
+		for _, c := range report.Currencies {
+			rows = append(rows, c.Days...)
+		}
+	case "showtimes":
+		header = []string{"Movie", "Showtime", "Currency", "Bookings", "Tickets", "Revenue", "Average Ticket Price", "Seats Booked", "Capacity", "Occupancy %"}
+		rows = report.Showtimes
+	default:
+		httpError(w, r, http.StatusBadRequest, "Unknown report")
+		return
+	}
+
+	filename := fmt.Sprintf("moobee-%s-%s-to-%s.csv", section, report.From, report.To)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, row := range rows {
+		if currency != "" && row.Currency != currency {
+			continue
+		}
+		record := []string{row.Label}
+		if section == "showtimes" {
+			record = append(record, row.Showtime)
+		}
+		record = append(record,
+			row.Currency,
+			strconv.Itoa(row.Bookings),
+			strconv.Itoa(row.Tickets),
+			row.Revenue.Decimal(row.Currency),
+			row.AveragePrice().Decimal(row.Currency),
+		)
+		if section == "showtimes" {
+			record = append(record,
+				strconv.Itoa(row.Booked),
+				strconv.Itoa(row.Capacity),
+				strconv.FormatFloat(row.Occupancy(), 'f', 1, 64),
+			)
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Error writing report CSV: %v", err)
+	}
+}
+
+// adminReportsHandler shows sales and occupancy reports for a date range,
+// or exports one section as CSV when ?export= is set
+func adminReportsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+
+	from, to := parseReportRange(r)
+	report, err := buildSalesReport(from, to)
+	if err != nil {
+		serverError(w, r, fmt.Errorf("building report: %w", err))
+		return
+	}
+
+	if section := r.URL.Query().Get("export"); section != "" {
+		writeReportCSV(w, r, report, section, r.URL.Query().Get("currency"))
+		return
+	}
+
+	data := struct {
+		User   User
+		Report SalesReport
+	}{
+		User:   user,
+		Report: report,
+	}
+
+	err = templates.Render(w, r, "admin_reports", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setCinemaZone switches MOOBEE_TIMEZONE for the test
+func setCinemaZone(t *testing.T, name string) *time.Location {
+	t.Helper()
+	t.Setenv("MOOBEE_TIMEZONE", name)
+	cinemaZoneOnce = sync.Once{}
+	t.Cleanup(func() { cinemaZoneOnce = sync.Once{} })
+	return cinemaLocation()
+}
+
+func TestRefundsAreReported(t *testing.T) {
+	newTestSite(t)
+	customer := createTestUser(t, "customer@example.com", false, false)
+	movie := createTestMovie(t, "Refund Matinee")
+	kept := createTestBooking(t, movie.ID, customer)
+	mutex.Lock()
+	refunded, err := createBooking(getMovie(movie.ID), []string{seatID(1, 0), seatID(1, 1)}, customer.Name, customer.Email, customer, bookingSale{})
+	if err == nil {
+		_, err = cancelBooking(refunded, bookingRefunded)
+	}
+	mutex.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var amount Money
+	var currency string
+	err = db.QueryRow("SELECT refund_minor, refund_currency FROM bookings WHERE id = ?", refunded).Scan(&amount, &currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amount != movie.Price.Times(2) || currency != movie.Currency {
+		t.Errorf("refund recorded as %d %s, want %d %s", amount, currency, movie.Price.Times(2), movie.Currency)
+	}
+
+	_, today := parseReportRange(httptest.NewRequest("GET", "/admin/reports", nil))
+	report, err := buildSalesReport(today, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sales := report.currency(movie.Currency)
+	if sales.Totals.Bookings != 1 || sales.Totals.Revenue != movie.Price {
+		t.Errorf("sales = %d booking(s), %d; want booking %d alone at %d", sales.Totals.Bookings, sales.Totals.Revenue, kept, movie.Price)
+	}
+	if sales.Refunds.Bookings != 1 || sales.Refunds.Revenue != movie.Price.Times(2) {
+		t.Errorf("refunds = %d booking(s), %d; want 1, %d", sales.Refunds.Bookings, sales.Refunds.Revenue, movie.Price.Times(2))
+	}
+}
+
+func TestReportDaysFollowCinemaTimeZone(t *testing.T) {
+	newTestSite(t)
+	loc := setCinemaZone(t, "America/New_York")
+	customer := createTestUser(t, "late@example.com", false, false)
+	movie := createTestMovie(t, "Midnight Movie")
+
+	// 22:30 on March 4th in New York is already March 5th in UTC
+	late := createTestBooking(t, movie.ID, customer)
+	db.Exec("UPDATE bookings SET date = '2024-03-05 03:30:00' WHERE id = ?", late)
+	// 00:30 on March 5th in New York is still 05:30 UTC
+	mutex.Lock()
+	early, err := createBooking(getMovie(movie.ID), []string{seatID(0, 1)}, customer.Name, customer.Email, customer, bookingSale{})
+	mutex.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("UPDATE bookings SET date = '2024-03-05 05:30:00' WHERE id = ?", early)
+	mutex.Lock()
+	cancelBooking(early, bookingRefunded)
+	mutex.Unlock()
+	db.Exec("UPDATE bookings SET refunded_at = '2024-03-06 04:00:00' WHERE id = ?", early)
+
+	day := func(s string) time.Time {
+		d, err := time.ParseInLocation(reportDateFormat, s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	sales := func(from, to string) *CurrencySales {
+		t.Helper()
+		report, err := buildSalesReport(day(from), day(to))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report.currency(movie.Currency)
+	}
+
+	if got := sales("2024-03-04", "2024-03-04").Totals.Bookings; got != 1 {
+		t.Errorf("March 4th has %d sales, want the late-evening one", got)
+	}
+	if got := sales("2024-03-05", "2024-03-05").Totals.Bookings; got != 0 {
+		t.Errorf("March 5th has %d sales, want none", got)
+	}
+
+	days := sales("2024-03-03", "2024-03-05").Days
+	if len(days) != 3 {
+		t.Fatalf("got %d days, want 3", len(days))
+	}
+	for i, want := range []int{0, 1, 0} {
+		if days[i].Bookings != want {
+			t.Errorf("%s has %d sales, want %d", days[i].Label, days[i].Bookings, want)
+		}
+	}
+
+	// Refunded at 23:00 on March 5th, New York time
+	if got := sales("2024-03-05", "2024-03-05").Refunds.Bookings; got != 1 {
+		t.Errorf("March 5th has %d refunds, want 1", got)
+	}
+	if got := sales("2024-03-06", "2024-03-06").Refunds.Bookings; got != 0 {
+		t.Errorf("March 6th has %d refunds, want none", got)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCleaningBuffer is the time kept free after each screening to clean
+// the auditorium, unless MOOBEE_CLEANING_BUFFER sets another number of minutes
+const defaultCleaningBuffer = 15 * time.Minute
+
+// cleaningBuffer returns the configured gap required between screenings
+func cleaningBuffer() time.Duration {
+	minutes, err := strconv.Atoi(envOr("MOOBEE_CLEANING_BUFFER", ""))
+	if err != nil || minutes < 0 {
+		return defaultCleaningBuffer
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Slot is the time a screening occupies its auditorium, including the
+// cleaning buffer after it
+type Slot struct {
+	Movie Movie
+	Start time.Time
+	End   time.Time
+}
+
+// screeningSlot works out when the movie occupies its auditorium
+func screeningSlot(movie Movie, buffer time.Duration) (Slot, error) {
+	if movie.Time.IsZero() {
+		return Slot{}, fmt.Errorf("showtime is required")
+	}
+	if movie.Runtime <= 0 {
+		return Slot{}, fmt.Errorf("runtime must be a positive number of minutes")
+	}
+	return Slot{Movie: movie, Start: movie.LocalTime(), End: movie.EndTime().Add(buffer)}, nil
+}
+
+// Overlaps reports whether the two slots share any time
+func (s Slot) Overlaps(other Slot) bool {
+	return s.Start.Before(other.End) && other.Start.Before(s.End)
+}
+
+// ScheduleConflictError lists the screenings a showtime clashes with
+type ScheduleConflictError struct {
+	Auditorium string
+	Conflicts  []Slot
+}
+
+func (e ScheduleConflictError) Error() string {
+	var clashes []string
+	for _, c := range e.Conflicts {
+		clashes = append(clashes, fmt.Sprintf("%s at %s", c.Movie.Title, c.Movie.ShowtimeLabel()))
+	}
+	return fmt.Sprintf("%s is already in use by %s", e.Auditorium, strings.Join(clashes, ", "))
+}
+
+// auditoriumSchedule loads the slots of every other screening in the auditorium.
+// Screenings without a showtime or runtime are left out.
+func auditoriumSchedule(auditorium string, excludeID int, buffer time.Duration) ([]Slot, error) {
+	rows, err := db.Query(
+		"SELECT id, title, starts_at, runtime, auditorium FROM movies WHERE auditorium = ? AND id != ? ORDER BY starts_at",
+		auditorium, excludeID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var slots []Slot
+	for rows.Next() {
+		var m Movie
+		if err := rows.Scan(&m.ID, &m.Title, &m.Time, &m.Runtime, &m.Auditorium); err != nil {
+			return nil, err
+		}
+		if slot, err := screeningSlot(m, buffer); err == nil {
+			slots = append(slots, slot)
+		}
+	}
+	return slots, rows.Err()
+}
+
+// checkSchedule validates the movie's showtime and runtime and makes sure
+// it doesn't overlap another screening in the same auditorium, counting the
+// cleaning buffer after each one. Extra slots, such as earlier rows of an
+// import, are checked as well. Conflicts are returned as a ScheduleConflictError.
+func checkSchedule(movie Movie, extra ...Slot) error {
+	if movie.Auditorium == "" {
+		movie.Auditorium = defaultAuditorium
+	}
+
+	buffer := cleaningBuffer()
+	slot, err := screeningSlot(movie, buffer)
+	if err != nil {
+		return err
+	}
+
+	existing, err := auditoriumSchedule(movie.Auditorium, movie.ID, buffer)
+	if err != nil {
+		return err
+	}
+
+	conflict := ScheduleConflictError{Auditorium: movie.Auditorium}
+	for _, other := range append(existing, extra...) {
+		if other.Movie.Auditorium == movie.Auditorium && slot.Overlaps(other) {
+			conflict.Conflicts = append(conflict.Conflicts, other)
+		}
+	}
+	if len(conflict.Conflicts) > 0 {
+		return conflict
+	}
+	return nil
+}
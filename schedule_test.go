@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestSampleMoviesDoNotOverlap(t *testing.T) {
+	newTestSite(t)
+
+	// A fresh site seeds the samples; any that clash are skipped
+	if len(movies) != 9 {
+		t.Fatalf("got %d sample movies, want 9", len(movies))
+	}
+	for _, movie := range movies {
+		if err := checkSchedule(movie); err != nil {
+			t.Errorf("%s: %v", movie.Title, err)
+		}
+	}
+}
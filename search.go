@@ -1,81 +1,449 @@
 package main
 
 import (
+	"database/sql"
+	"html/template"
+	"log"
 	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
-func searchMovies(query string) []Movie {
-	if query == "" {
-		return movies
+// ftsEnabled is set once the movies_fts full-text index is ready. SQLite
+// only has FTS5 when built with the sqlite_fts5 tag; without it, search
+// falls back to LIKE matching.
+var ftsEnabled bool
+
+// searchWeights rank a match in the title above one in the cast, director
+// or genre, and those above a mention in the synopsis. They are in the
+// order of the movies_fts columns.
+const searchWeights = "10.0, 1.0, 4.0, 2.0, 3.0, 1.0"
+
+// Highlight and snippet markers, char(2) and char(3) in SQL, replaced with
+// <mark> once the text has been escaped
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+var searchTermPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// SearchResult is a movie found by a search. The highlights mark the words
+// that matched; Cast and Synopsis are only set when the match was there.
+type SearchResult struct {
+	Movie
+	Highlights struct {
+		Title    template.HTML
+		Director template.HTML
+		Cast     template.HTML
+		Synopsis template.HTML
+	}
+}
+
+// setupSearchIndex creates the full-text index of movies and fills it from
+// the movies table. It is rebuilt on every start, which is cheap for a
+// cinema's programme and picks up changes made by a build without FTS5.
+func setupSearchIndex() {
+	err := func() error {
+		statements := []string{
+			`CREATE VIRTUAL TABLE IF NOT EXISTS movies_fts USING fts5(
+                title, synopsis, cast_members, genre, director, language,
+                tokenize = 'unicode61 remove_diacritics 2'
+            )`,
+			`CREATE VIRTUAL TABLE IF NOT EXISTS movies_fts_vocab USING fts5vocab(movies_fts, 'row')`,
+		}
+		for _, stmt := range statements {
+			if _, err := db.Exec(stmt); err != nil {
+				return err
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec("DELETE FROM movies_fts"); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+            INSERT INTO movies_fts (rowid, title, synopsis, cast_members, genre, director, language)
+            SELECT id, title, synopsis, cast_members, genre, director, language FROM movies
+        `)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		// Default builds of the SQLite driver leave FTS5 out
+		log.Println("WARNING: Full-text search unavailable, this binary was built without FTS5. Search falls back to simple matching without ranking or typo tolerance; rebuild with: go build -tags sqlite_fts5")
+		return
+	} else if err != nil {
+		log.Printf("Warning: Full-text search unavailable, using simple matching: %v", err)
+		return
+	}
+	ftsEnabled = true
+}
+
+// indexMovie adds the movie to the full-text index, replacing its old entry
+func indexMovie(tx *sql.Tx, movie *Movie) error {
+	if !ftsEnabled {
+		return nil
+	}
+	if _, err := tx.Exec("DELETE FROM movies_fts WHERE rowid = ?", movie.ID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		"INSERT INTO movies_fts (rowid, title, synopsis, cast_members, genre, director, language) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		movie.ID, movie.Title, movie.Synopsis, movie.Cast, movie.Genre, movie.Director, movie.Language,
+	)
+	return err
+}
+
+// unindexMovie removes a deleted movie from the full-text index
+func unindexMovie(id int) error {
+	if !ftsEnabled {
+		return nil
+	}
+	_, err := db.Exec("DELETE FROM movies_fts WHERE rowid = ?", id)
+	return err
+}
+
+// searchTerms splits a query into lower-case words, dropping punctuation
+// that would otherwise be read as FTS5 syntax
+func searchTerms(query string) []string {
+	return searchTermPattern.FindAllString(strings.ToLower(query), -1)
+}
+
+// matchExpression builds the FTS5 query for the words. Every word has to
+// match the start of a word in the index, so "star" finds "Stardust". A
+// word that starts nothing in the index is treated as a typo and also
+// matches the indexed words within one or two edits of it.
+func matchExpression(terms []string) (string, error) {
+	var parts []string
+	for _, term := range terms {
+		alternatives := []string{`"` + term + `"*`}
+
+		found, err := indexHasPrefix(term)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			similar, err := similarTerms(term)
+			if err != nil {
+				return "", err
+			}
+			for _, s := range similar {
+				alternatives = append(alternatives, `"`+s+`"`)
+			}
+		}
+		parts = append(parts, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	return strings.Join(parts, " AND "), nil
+}
+
+// indexHasPrefix reports whether any indexed word starts with prefix
+func indexHasPrefix(prefix string) (bool, error) {
+	var found int
+	err := db.QueryRow(
+		"SELECT 1 FROM movies_fts_vocab WHERE term >= ? AND term < ? LIMIT 1",
+		prefix, prefix+string(utf8.MaxRune),
+	).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// similarTerms returns the indexed words closest to a misspelt term, at
+// most one edit away for short words and two for longer ones. Words of
+// under four letters are too short to guess at.
+func similarTerms(term string) ([]string, error) {
+	length := utf8.RuneCountInString(term)
+	maxEdits := 1
+	switch {
+	case length < 4:
+		return nil, nil
+	case length >= 8:
+		maxEdits = 2
+	}
+
+	rows, err := db.Query(
+		"SELECT term FROM movies_fts_vocab WHERE length(term) BETWEEN ? AND ?",
+		length-maxEdits, length+maxEdits,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type candidate struct {
+		term  string
+		edits int
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var word string
+		if err := rows.Scan(&word); err != nil {
+			return nil, err
+		}
+		if edits := editDistance(term, word); edits <= maxEdits {
+			candidates = append(candidates, candidate{word, edits})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].edits < candidates[j].edits })
+	if len(candidates) > 10 {
+		candidates = candidates[:10]
+	}
+	similar := make([]string, len(candidates))
+	for i, c := range candidates {
+		similar[i] = c.term
+	}
+	return similar, nil
+}
+
+// editDistance is the Levenshtein distance between two words
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// markHTML escapes text from the index and turns the match markers into
+// <mark> tags
+func markHTML(s string) template.HTML {
+	s = template.HTMLEscapeString(s)
+	s = strings.ReplaceAll(s, markStart, "<mark>")
+	return template.HTML(strings.ReplaceAll(s, markEnd, "</mark>"))
+}
+
+// searchMovies finds movies matching the query, optionally limited to one
+// genre. With the full-text index, results are ranked by relevance and the
+// matching words highlighted; otherwise the query is matched as a substring
+// of the title, genre, cast, director, language and synopsis.
+func searchMovies(query, genre string) []SearchResult {
+	if query == "" && genre == "" {
+		results := make([]SearchResult, len(movies))
+		for i, m := range movies {
+			results[i].Movie = m
+		}
+		plainHighlights(results)
+		return results
+	}
+
+	if terms := searchTerms(query); ftsEnabled && len(terms) > 0 {
+		results, err := searchIndex(terms, genre)
+		if err == nil {
+			return results
+		}
+		log.Printf("Error searching the full-text index, using simple matching: %v", err)
+	}
+	return searchLike(query, genre)
+}
+
+// searchIndex runs a ranked full-text search
+func searchIndex(terms []string, genre string) ([]SearchResult, error) {
+	match, err := matchExpression(terms)
+	if err != nil {
+		return nil, err
+	}
+
+	where := ""
+	args := []interface{}{match}
+	if genre != "" {
+		where = "WHERE genre = ?"
+		args = append(args, genre)
+	}
+
+	rows, err := db.Query(`
+        SELECT `+movieColumns+`, hl_title, hl_director, hl_cast, hl_synopsis
+        FROM movies
+        JOIN (
+            SELECT rowid AS match_id,
+                bm25(movies_fts, `+searchWeights+`) AS score,
+                highlight(movies_fts, 0, char(2), char(3)) AS hl_title,
+                highlight(movies_fts, 4, char(2), char(3)) AS hl_director,
+                highlight(movies_fts, 2, char(2), char(3)) AS hl_cast,
+                snippet(movies_fts, 1, char(2), char(3), '…', 16) AS hl_synopsis
+            FROM movies_fts
+            WHERE movies_fts MATCH ?
+        ) ON id = match_id
+        `+where+`
+        ORDER BY score, starts_at, title
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var title, director, cast, synopsis string
+		err := scanMovie(scanWithExtra{rows, []interface{}{&title, &director, &cast, &synopsis}}, &r.Movie)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Highlights.Title = markHTML(title)
+		r.Highlights.Director = markHTML(director)
+		if strings.Contains(cast, markStart) {
+			r.Highlights.Cast = markHTML(cast)
+		}
+		if strings.Contains(synopsis, markStart) {
+			r.Highlights.Synopsis = markHTML(synopsis)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	loadResultSeats(results)
+	return results, nil
+}
+
+// scanWithExtra scans the movie columns followed by extra columns
+type scanWithExtra struct {
+	rowScanner
+	extra []interface{}
+}
+
+func (s scanWithExtra) Scan(dest ...interface{}) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
+
+// searchLike matches the query as a substring, for when SQLite has no FTS5
+func searchLike(query, genre string) []SearchResult {
+	var conds []string
+	var args []interface{}
+	if query != "" {
+		like := "%" + query + "%"
+		conds = append(conds, "(title LIKE ? OR genre LIKE ? OR cast_members LIKE ? OR director LIKE ? OR language LIKE ? OR synopsis LIKE ?)")
+		args = append(args, like, like, like, like, like, like)
+	}
+	if genre != "" {
+		conds = append(conds, "genre = ?")
+		args = append(args, genre)
 	}
 
-	// Case-insensitive search in SQLite
 	rows, err := db.Query(
-		"SELECT id, title, time, duration, image, price FROM movies WHERE title LIKE ?",
-		"%"+query+"%",
+		"SELECT "+movieColumns+" FROM movies WHERE "+strings.Join(conds, " AND ")+" ORDER BY starts_at, title",
+		args...,
 	)
 	if err != nil {
 		return nil
 	}
 	defer rows.Close()
 
-	var results []Movie
+	var results []SearchResult
 	for rows.Next() {
-		var movie Movie
-		if err := rows.Scan(&movie.ID, &movie.Title, &movie.Time, &movie.Duration, &movie.Image, &movie.Price); err != nil {
+		var r SearchResult
+		if err := scanMovie(rows, &r.Movie); err != nil {
 			continue
 		}
+		results = append(results, r)
+	}
+
+	loadResultSeats(results)
+	plainHighlights(results)
+	return results
+}
+
+// plainHighlights fills in the title and director for results that have
+// no highlighting
+func plainHighlights(results []SearchResult) {
+	for i := range results {
+		r := &results[i]
+		r.Highlights.Title = template.HTML(template.HTMLEscapeString(r.Title))
+		r.Highlights.Director = template.HTML(template.HTMLEscapeString(r.Director))
+	}
+}
+
+// loadResultSeats fills in the seat map and seat blocks of each result
+func loadResultSeats(results []SearchResult) {
+	list := make([]Movie, len(results))
+	for i := range results {
+		movie := &results[i].Movie
 
 		// Initialize the seats array
-		movie.Seats = make([][]bool, 8)
+		movie.Seats = make([][]bool, seatGridRows)
 		for i := range movie.Seats {
-			movie.Seats[i] = make([]bool, 10)
+			movie.Seats[i] = make([]bool, seatGridCols)
 		}
 
 		// Load seat information
 		seatRows, err := db.Query("SELECT row, col, is_booked FROM seats WHERE movie_id = ?", movie.ID)
-		if err != nil {
-			continue
-		}
-
-		for seatRows.Next() {
-			var row, col, isBooked int
-			if err := seatRows.Scan(&row, &col, &isBooked); err != nil {
-				continue
-			}
+		if err == nil {
+			for seatRows.Next() {
+				var row, col, isBooked int
+				if err := seatRows.Scan(&row, &col, &isBooked); err != nil {
+					continue
+				}
 
-			if row < len(movie.Seats) && col < len(movie.Seats[row]) {
-				movie.Seats[row][col] = isBooked == 1
+				if row < len(movie.Seats) && col < len(movie.Seats[row]) {
+					movie.Seats[row][col] = isBooked == 1
+				}
 			}
+			seatRows.Close()
 		}
-		seatRows.Close()
-
-		results = append(results, movie)
+		list[i] = *movie
 	}
 
-	return results
+	loadSeatBlocks(list)
+	for i := range results {
+		results[i].Movie = list[i]
+	}
 }
 
 func searchHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	genre := r.URL.Query().Get("genre")
 
-	results := searchMovies(query)
+	results := searchMovies(query, genre)
 
 	// Get user if logged in
 	user, _ := getUserFromSession(r)
 
 	data := struct {
 		Query  string
-		Movies []Movie
+		Genre  string
+		Genres []string
+		Movies []SearchResult
 		User   User
 	}{
 		Query:  query,
+		Genre:  genre,
+		Genres: movieGenres(),
 		Movies: results,
 		User:   user,
 	}
 
-	err := templates.ExecuteTemplate(w, "search", data)
+	err := templates.Render(w, r, "search", data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// createSearchMovie saves a movie days from now, so tests control the order
+// results would have without ranking
+func createSearchMovie(t *testing.T, title, synopsis, genre string, days int) Movie {
+	t.Helper()
+	movie := Movie{
+		Title:    title,
+		Time:     time.Now().AddDate(0, 0, days).Truncate(time.Minute),
+		Runtime:  100,
+		Price:    1000,
+		Currency: "USD",
+		Genre:    genre,
+		Synopsis: synopsis,
+		Director: "Ida Lund",
+	}
+	if err := saveMovie(&movie); err != nil {
+		t.Fatalf("saveMovie: %v", err)
+	}
+	loadMovies()
+	return movie
+}
+
+// requireFTS skips tests of the full-text index in builds without FTS5
+func requireFTS(t *testing.T) {
+	t.Helper()
+	if !ftsEnabled {
+		t.Skip("built without FTS5; run go test -tags sqlite_fts5")
+	}
+}
+
+func resultTitles(results []SearchResult) []string {
+	titles := make([]string, len(results))
+	for i, r := range results {
+		titles[i] = r.Title
+	}
+	return titles
+}
+
+func TestSearchFiltersByGenre(t *testing.T) {
+	newTestSite(t)
+	createSearchMovie(t, "Lighthouse Keeper", "Storms batter the coast.", "Drama", 3)
+	createSearchMovie(t, "Lighthouse Run", "A heist on the coast.", "Thriller", 4)
+
+	got := resultTitles(searchMovies("lighthouse", "Thriller"))
+	if len(got) != 1 || got[0] != "Lighthouse Run" {
+		t.Errorf("lighthouse in Thriller = %v", got)
+	}
+	if got := searchMovies("", ""); len(got) != len(movies) {
+		t.Errorf("an empty search found %d movies, want all %d", len(got), len(movies))
+	}
+	if got := resultTitles(searchMovies("nothing-like-this", "")); len(got) != 0 {
+		t.Errorf("unmatched search = %v", got)
+	}
+}
+
+func TestSearchRanksTitleMatchesFirst(t *testing.T) {
+	newTestSite(t)
+	requireFTS(t)
+
+	// The synopsis mention plays first, but the title match is more relevant
+	createSearchMovie(t, "Moonlit Harbour", "A lighthouse keeper waits for a ship.", "Drama", 2)
+	createSearchMovie(t, "Lighthouse Keeper", "Storms batter the coast.", "Drama", 3)
+
+	results := searchMovies("lighthouse", "")
+	if got := resultTitles(results); len(got) != 2 || got[0] != "Lighthouse Keeper" {
+		t.Fatalf("lighthouse = %v, want Lighthouse Keeper first", got)
+	}
+	if title := string(results[0].Highlights.Title); title != "<mark>Lighthouse</mark> Keeper" {
+		t.Errorf("title highlight = %q", title)
+	}
+	if synopsis := string(results[1].Highlights.Synopsis); !strings.Contains(synopsis, "<mark>lighthouse</mark>") {
+		t.Errorf("synopsis highlight = %q", synopsis)
+	}
+	if results[0].Highlights.Synopsis != "" {
+		t.Errorf("synopsis without a match is highlighted: %q", results[0].Highlights.Synopsis)
+	}
+}
+
+func TestSearchMatchesPrefixesAndTypos(t *testing.T) {
+	newTestSite(t)
+	requireFTS(t)
+	createSearchMovie(t, "Lighthouse Keeper", "Storms batter the coast.", "Drama", 3)
+	createSearchMovie(t, "Moonlit Harbour", "A ship comes home.", "Drama", 2)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"lightho", []string{"Lighthouse Keeper"}},
+		{"LIGHTHOUSE keep", []string{"Lighthouse Keeper"}},
+		{"lihgthouse", []string{"Lighthouse Keeper"}}, // two edits in a long word
+		{"harbuor", nil}, // two edits in a short word are too many
+		{"harbor", []string{"Moonlit Harbour"}},
+		{"moonlit keeper", nil},
+		{"shipp", []string{"Moonlit Harbour"}},
+		{"hrbour's \"coast\"", nil}, // quotes and apostrophes aren't FTS5 syntax
+	}
+	for _, tt := range tests {
+		if got := resultTitles(searchMovies(tt.query, "")); strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("%q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchIndexFollowsMovieChanges(t *testing.T) {
+	newTestSite(t)
+	requireFTS(t)
+	movie := createSearchMovie(t, "Lighthouse Keeper", "Storms batter the coast.", "Drama", 3)
+
+	movie.Title = "Foghorn Nights"
+	if err := saveMovie(&movie); err != nil {
+		t.Fatal(err)
+	}
+	if got := resultTitles(searchMovies("lighthouse", "")); len(got) != 0 {
+		t.Errorf("old title still found: %v", got)
+	}
+	if got := resultTitles(searchMovies("foghorn", "")); len(got) != 1 {
+		t.Errorf("new title not found: %v", got)
+	}
+
+	if err := deleteMovie(movie.ID); err != nil {
+		t.Fatal(err)
+	}
+	var indexed int
+	db.QueryRow("SELECT COUNT(*) FROM movies_fts WHERE rowid = ?", movie.ID).Scan(&indexed)
+	if indexed != 0 {
+		t.Error("the deleted movie is still in the index")
+	}
+	if got := resultTitles(searchMovies("foghorn", "")); len(got) != 0 {
+		t.Errorf("deleted movie found: %v", got)
+	}
+}
+
+func TestSearchFallsBackToSubstrings(t *testing.T) {
+	newTestSite(t)
+	enabled := ftsEnabled
+	ftsEnabled = false
+	t.Cleanup(func() { ftsEnabled = enabled })
+
+	createSearchMovie(t, "Lighthouse Keeper", "Storms batter the coast.", "Drama", 3)
+	createSearchMovie(t, "Moonlit Harbour", "A lighthouse <keeper> waits.", "Drama", 2)
+
+	// Matches anywhere in a word, in showtime order
+	results := searchMovies("ghthou", "")
+	if got := resultTitles(results); strings.Join(got, ", ") != "Moonlit Harbour, Lighthouse Keeper" {
+		t.Fatalf("ghthou = %v", got)
+	}
+	if title := string(results[1].Highlights.Title); title != "Lighthouse Keeper" {
+		t.Errorf("title without highlighting = %q", title)
+	}
+	if got := resultTitles(searchMovies("ida lund", "")); len(got) != 2 {
+		t.Errorf("director search = %v", got)
+	}
+	if got := resultTitles(searchMovies("lihgthouse", "")); len(got) != 0 {
+		t.Errorf("typo matched without the index: %v", got)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultAuditorium is used for movies created before auditoriums existed
+	defaultAuditorium = "Screen 1"
+
+	// Every auditorium has the same grid of seats
+	seatGridRows = 8
+	seatGridCols = 10
+
+	// seatBlocked takes a seat out of sale, e.g. because it is broken
+	seatBlocked = "blocked"
+	// seatHouse reserves a seat for press or house use. Only admins can book it.
+	seatHouse = "house"
+)
+
+// SeatBlock is a seat taken out of public sale for one screening, or for
+// every screening in an auditorium when MovieID is zero
+type SeatBlock struct {
+	ID         int
+	MovieID    int
+	Auditorium string
+	Row        int
+	Col        int
+	Kind       string
+	Note       string
+}
+
+// seatID formats a seat the way the booking API and templates refer to it
+func seatID(row, col int) string {
+	return fmt.Sprintf("%d-%d", row, col)
+}
+
+// parseSeat reads a "row-col" seat ID and checks it is inside the grid
+func parseSeat(s string) (int, int, error) {
+	var row, col int
+	if n, err := fmt.Sscanf(s, "%d-%d", &row, &col); err != nil || n != 2 || seatID(row, col) != s {
+		return 0, 0, fmt.Errorf("invalid seat %q", s)
+	}
+	if row < 0 || row >= seatGridRows || col < 0 || col >= seatGridCols {
+		return 0, 0, fmt.Errorf("seat %s does not exist", s)
+	}
+	return row, col, nil
+}
+
+// BlockAt returns how the seat is held back from sale, or "" if it isn't
+func (m Movie) BlockAt(row, col int) string {
+	return m.Blocks[seatID(row, col)]
+}
+
+// seatAvailable reports whether the seat can be sold. Admins may sell house seats.
+func (m Movie) seatAvailable(row, col int, admin bool) bool {
+	if row < 0 || row >= len(m.Seats) || col < 0 || col >= len(m.Seats[row]) || m.Seats[row][col] {
+		return false
+	}
+	switch m.BlockAt(row, col) {
+	case "":
+		return true
+	case seatHouse:
+		return admin
+	default:
+		return false
+	}
+}
+
+// availableSeats counts the seats still on public sale
+func availableSeats(movie Movie) int {
+	count := 0
+	for r, row := range movie.Seats {
+		for c := range row {
+			if movie.seatAvailable(r, c, false) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// loadSeatBlocks fills in each movie's blocked and house seats, combining
+// its own blocks with the permanent ones for its auditorium
+func loadSeatBlocks(list []Movie) {
+	blocks, err := listSeatBlocks()
+	if err != nil {
+		log.Println("Error loading seat blocks:", err)
+		return
+	}
+
+	for i := range list {
+		list[i].Blocks = make(map[string]string)
+		for _, b := range blocks {
+			if b.MovieID == list[i].ID || (b.MovieID == 0 && b.Auditorium == list[i].Auditorium) {
+				// A screening's own block wins over the auditorium's
+				if _, set := list[i].Blocks[seatID(b.Row, b.Col)]; !set || b.MovieID != 0 {
+					list[i].Blocks[seatID(b.Row, b.Col)] = b.Kind
+				}
+			}
+		}
+	}
+}
+
+// listSeatBlocks returns every seat block
+func listSeatBlocks() ([]SeatBlock, error) {
+	rows, err := db.Query(`
+        SELECT id, COALESCE(movie_id, 0), auditorium, row, col, kind, note
+        FROM seat_blocks
+        ORDER BY row, col
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []SeatBlock
+	for rows.Next() {
+		var b SeatBlock
+		if err := rows.Scan(&b.ID, &b.MovieID, &b.Auditorium, &b.Row, &b.Col, &b.Kind, &b.Note); err != nil {
+			log.Println("Error scanning seat block:", err)
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
+// setSeatBlocks blocks or reserves the seats for the screening, or for its
+// whole auditorium when permanent is set. An empty kind releases them.
+func setSeatBlocks(movie Movie, seats []string, kind, note string, permanent bool) error {
+	if kind != "" && kind != seatBlocked && kind != seatHouse {
+		return fmt.Errorf("unknown seat status %q", kind)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, s := range seats {
+		row, col, err := parseSeat(s)
+		if err != nil {
+			return err
+		}
+
+		if permanent {
+			_, err = tx.Exec(
+				"DELETE FROM seat_blocks WHERE movie_id IS NULL AND auditorium = ? AND row = ? AND col = ?",
+				movie.Auditorium, row, col,
+			)
+		} else {
+			_, err = tx.Exec(
+				"DELETE FROM seat_blocks WHERE movie_id = ? AND row = ? AND col = ?",
+				movie.ID, row, col,
+			)
+		}
+		if err != nil {
+			return err
+		}
+
+		if kind == "" {
+			continue
+		}
+
+		var movieID interface{} = movie.ID
+		if permanent {
+			movieID = nil
+		}
+		_, err = tx.Exec(
+			"INSERT INTO seat_blocks (movie_id, auditorium, row, col, kind, note) VALUES (?, ?, ?, ?, ?, ?)",
+			movieID, movie.Auditorium, row, col, kind, note,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// adminSeatsHandler shows a screening's seat map and lets admins block,
+// reserve or release seats for it or for its auditorium
+func adminSeatsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromSession(r)
+
+	id, err := strconv.Atoi(strings.Trim(r.URL.Path[len("/admin/movies/seats/"):], "/"))
+	if err != nil {
+		httpError(w, r, http.StatusBadRequest, "Invalid movie ID")
+		return
+	}
+
+	movie := getMovie(id)
+	if movie == nil {
+		httpError(w, r, http.StatusNotFound, "Movie not found")
+		return
+	}
+
+	var message, actionError string
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			httpError(w, r, http.StatusBadRequest, "Error parsing form")
+			return
+		}
+
+		seats := r.PostForm["seats"]
+		kind := r.PostFormValue("kind")
+		permanent := r.PostFormValue("scope") == "auditorium"
+		note := strings.TrimSpace(r.PostFormValue("note"))
+
+		if len(seats) == 0 {
+			actionError = "Select at least one seat"
+		} else if err := setSeatBlocks(*movie, seats, kind, note, permanent); err != nil {
+			actionError = err.Error()
+		} else {
+			scope := "screening"
+			target := strconv.Itoa(movie.ID)
+			if permanent {
+				scope = "auditorium"
+				target = movie.Auditorium
+			}
+			action := "seat.block"
+			if kind == "" {
+				action = "seat.release"
+			}
+			recordAudit(r, user, action, scope, target, nil, map[string]interface{}{
+				"seats": seats,
+				"kind":  kind,
+				"note":  note,
+			})
+
+			loadMovies()
+			movie = getMovie(id)
+			message = fmt.Sprintf("Updated %d seat(s)", len(seats))
+		}
+	}
+
+	// Notes are shown as seat tooltips
+	notes := make(map[string]string)
+	var blocks []SeatBlock
+	if all, err := listSeatBlocks(); err == nil {
+		for _, b := range all {
+			if b.MovieID == movie.ID || (b.MovieID == 0 && b.Auditorium == movie.Auditorium) {
+				blocks = append(blocks, b)
+				if b.Note != "" {
+					notes[seatID(b.Row, b.Col)] = b.Note
+				}
+			}
+		}
+	}
+
+	data := struct {
+		User     User
+		Movie    *Movie
+		Blocks   []SeatBlock
+		Notes    map[string]string
+		SellOnly bool
+		Message  string
+		Error    string
+	}{
+		User:    user,
+		Movie:   movie,
+		Blocks:  blocks,
+		Notes:   notes,
+		Message: message,
+		Error:   actionError,
+	}
+
+	err = templates.Render(w, r, "admin_seats", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBookingRespectsSeatBlocks(t *testing.T) {
+	newTestSite(t)
+	admin := createTestUser(t, "admin@example.com", true, false)
+	staff := createTestUser(t, "staff@example.com", false, true)
+	customer := createTestUser(t, "customer@example.com", false, false)
+	movie := createTestMovie(t, "Blocked Matinee")
+	other := createTestMovie(t, "Other Matinee")
+
+	blocks := []struct {
+		seat      string
+		kind      string
+		permanent bool
+	}{
+		{seatID(2, 0), seatBlocked, false},
+		{seatID(2, 1), seatHouse, false},
+		{seatID(2, 2), seatBlocked, true},
+		{seatID(2, 3), seatHouse, true},
+	}
+	for _, b := range blocks {
+		if err := setSeatBlocks(movie, []string{b.seat}, b.kind, "", b.permanent); err != nil {
+			t.Fatalf("setSeatBlocks(%s, %s): %v", b.seat, b.kind, err)
+		}
+	}
+	loadMovies()
+
+	book := func(movieID int, user User, seat string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		_, err := createBooking(getMovie(movieID), []string{seat}, user.Name, user.Email, user, bookingSale{})
+		return err
+	}
+	unavailable := func(err error) bool {
+		var e seatUnavailableError
+		return errors.As(err, &e)
+	}
+
+	tests := []struct {
+		name  string
+		user  User
+		seat  string
+		taken bool
+	}{
+		{"customer, blocked seat", customer, seatID(2, 0), true},
+		{"staff, blocked seat", staff, seatID(2, 0), true},
+		{"admin, blocked seat", admin, seatID(2, 0), true},
+		{"customer, house seat", customer, seatID(2, 1), true},
+		{"customer, auditorium block", customer, seatID(2, 2), true},
+		{"customer, auditorium house seat", customer, seatID(2, 3), true},
+		{"staff, house seat", staff, seatID(2, 1), false},
+		{"admin, auditorium house seat", admin, seatID(2, 3), false},
+		{"customer, open seat", customer, seatID(2, 4), false},
+	}
+	for _, tt := range tests {
+		err := book(movie.ID, tt.user, tt.seat)
+		if tt.taken && !unavailable(err) {
+			t.Errorf("%s: error = %v, want the seat to be unavailable", tt.name, err)
+		} else if !tt.taken && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+
+	// Auditorium blocks reach other screenings there; a screening's own don't
+	if err := book(other.ID, customer, seatID(2, 2)); !unavailable(err) {
+		t.Errorf("auditorium block on another screening: error = %v", err)
+	}
+	if err := book(other.ID, customer, seatID(2, 0)); err != nil {
+		t.Errorf("another screening's block: %v", err)
+	}
+
+	// Releasing a block puts the seat back on sale
+	if err := setSeatBlocks(movie, []string{seatID(2, 0)}, "", "", false); err != nil {
+		t.Fatal(err)
+	}
+	loadMovies()
+	if err := book(movie.ID, customer, seatID(2, 0)); err != nil {
+		t.Errorf("released seat: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const settingSetupToken = "setup_token_hash"
+
+// setupPending is true while the database has no admin account
+var setupPending atomic.Bool
+
+// ensureAdminUser makes sure there's at least one admin user in the system.
+// On a fresh database it prints a one-time setup link instead of creating a
+// default account, and the site only serves the setup page until it is used.
+func ensureAdminUser() error {
+	// Check if admin exists
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin = 1").Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		setupPending.Store(false)
+		warnDefaultAdmin()
+		return nil
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	token = strings.TrimRight(token, "=")
+
+	if err := setSetting(settingSetupToken, hashToken(token)); err != nil {
+		return err
+	}
+	setupPending.Store(true)
+
+	log.Printf("No admin account exists. Create one at %s/setup?token=%s", baseURL(), token)
+	log.Printf("or run: moobee admin -email you@example.com -name \"Your Name\" -password-stdin")
+
+	return nil
+}
+
+// warnDefaultAdmin flags databases that still have the credentials older
+// versions created automatically
+func warnDefaultAdmin() {
+	var hash string
+	err := db.QueryRow(
+		"SELECT password FROM users WHERE email = ? AND is_admin = 1",
+		"admin@example.com",
+	).Scan(&hash)
+	if err == nil && comparePasswords(hash, "admin123") {
+		log.Println("WARNING: the default admin@example.com / admin123 account is still active. Change its password or remove it.")
+	}
+}
+
+// createOrResetAdmin creates an admin account, or promotes an existing
+// account and resets its password and two-factor sign-in, so a locked-out
+// admin can get back in. Any existing sessions are ended.
+func createOrResetAdmin(name, email, password string) (int, bool, error) {
+	email = strings.TrimSpace(email)
+	if email == "" || !strings.Contains(email, "@") {
+		return 0, false, errors.New("a valid email address is required")
+	}
+	if len(password) < 8 {
+		return 0, false, errors.New("password must be at least 8 characters")
+	}
+
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return 0, false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	created := false
+	err = tx.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
+	if err == nil {
+		_, err = tx.Exec(
+			"UPDATE users SET password = ?, is_admin = 1, disabled = 0, totp_secret = '', totp_enabled = 0 WHERE id = ?",
+			hashedPassword, userID,
+		)
+		if err != nil {
+			return 0, false, err
+		}
+		if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+			return 0, false, err
+		}
+		if name != "" {
+			if _, err := tx.Exec("UPDATE users SET name = ? WHERE id = ?", name, userID); err != nil {
+				return 0, false, err
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+			return 0, false, err
+		}
+	} else {
+		if name == "" {
+			return 0, false, errors.New("a name is required for a new account")
+		}
+		result, err := tx.Exec(
+			"INSERT INTO users (name, email, password, is_admin) VALUES (?, ?, ?, ?)",
+			name, email, hashedPassword, 1,
+		)
+		if err != nil {
+			return 0, false, err
+		}
+		lastID, err := result.LastInsertId()
+		if err != nil {
+			return 0, false, err
+		}
+		userID = int(lastID)
+		created = true
+	}
+
+	if _, err := tx.Exec("DELETE FROM settings WHERE key = ?", settingSetupToken); err != nil {
+		return 0, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+
+	setupPending.Store(false)
+	return userID, created, nil
+}
+
+// setupRequired reports whether the site is still waiting for its first
+// admin. While it is, the database is checked on each call, because the
+// admin command may have created an admin from another process.
+func setupRequired() bool {
+	if !setupPending.Load() {
+		return false
+	}
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin = 1").Scan(&count)
+	if err != nil {
+		log.Printf("Error checking for admin users: %v", err)
+		return true
+	}
+	if count > 0 {
+		setupPending.Store(false)
+		return false
+	}
+	return true
+}
+
+// setupMiddleware sends every page to the setup wizard until an admin exists
+func setupMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/setup" && !strings.HasPrefix(r.URL.Path, "/static/") && setupRequired() {
+			http.Redirect(w, r, "/setup", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setupHandler is the first-run wizard that creates the initial admin account
+func setupHandler(w http.ResponseWriter, r *http.Request) {
+	if !setupRequired() {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Error string
+		Token string
+		Name  string
+		Email string
+	}{
+		Token: r.FormValue("token"),
+		Name:  r.FormValue("name"),
+		Email: r.FormValue("email"),
+	}
+
+	if r.Method == http.MethodPost {
+		password := r.FormValue("password")
+
+		expected := getSetting(settingSetupToken, "")
+		given := hashToken(strings.TrimSpace(data.Token))
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(given)) != 1 {
+			data.Error = "Invalid setup token. Use the link printed in the server log."
+		} else if password != r.FormValue("password2") {
+			data.Error = "Passwords do not match"
+		} else if strings.TrimSpace(data.Name) == "" {
+			data.Error = "All fields are required"
+		} else if userID, _, err := createOrResetAdmin(strings.TrimSpace(data.Name), data.Email, password); err != nil {
+			data.Error = err.Error()
+		} else {
+			token, err := createSession(userID, false)
+			if err != nil {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+
+			admin, _ := getUser(userID)
+			recordAudit(r, admin, "user.admin_setup", "user", userID, nil, auditUser(admin))
+			log.Printf("Created admin user %s via setup wizard", data.Email)
+			setSessionCookie(w, token, sessionDuration)
+			http.Redirect(w, r, "/admin", http.StatusSeeOther)
+			return
+		}
+	}
+
+	err := templates.Render(w, r, "setup", data)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // so MOOBEE_TIMEZONE works on hosts without zoneinfo
+)
+
+const (
+	// showtimeFormat is the layout showtimes are entered and imported in,
+	// as wall-clock time in the cinema's time zone
+	showtimeFormat = "2006-01-02 15:04"
+	// showtimeInputFormat is what <input type="datetime-local"> submits
+	showtimeInputFormat = "2006-01-02T15:04"
+	// showtimeDisplayFormat is how showtimes are shown to customers
+	showtimeDisplayFormat = "Mon, Jan 2 2006 · 3:04 PM"
+)
+
+var durationPattern = regexp.MustCompile(`^(\d+h)?\s*(\d+m)?$`)
+
+var (
+	cinemaZone     *time.Location
+	cinemaZoneOnce sync.Once
+)
+
+// cinemaLocation is the time zone showtimes are entered and shown in, set
+// with MOOBEE_TIMEZONE (e.g. Europe/London). It defaults to the server's.
+func cinemaLocation() *time.Location {
+	cinemaZoneOnce.Do(func() {
+		cinemaZone = time.Local
+		if name := envOr("MOOBEE_TIMEZONE", ""); name != "" {
+			loc, err := time.LoadLocation(name)
+			if err != nil {
+				log.Printf("Unknown MOOBEE_TIMEZONE %q, using the server time zone: %v", name, err)
+				return
+			}
+			cinemaZone = loc
+		}
+	})
+	return cinemaZone
+}
+
+// parseShowtime reads a showtime entered in the cinema's time zone, either
+// as 2024-01-31 19:30 or in the datetime-local form 2024-01-31T19:30. Times
+// skipped when the clocks go forward are rejected rather than moved.
+func parseShowtime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{showtimeFormat, showtimeInputFormat} {
+		if t, err := time.ParseInLocation(layout, s, cinemaLocation()); err == nil {
+			if wall, _ := time.Parse(layout, s); t.Format(showtimeFormat) != wall.Format(showtimeFormat) {
+				return time.Time{}, fmt.Errorf("showtime %s does not exist in %s because the clocks go forward", wall.Format(showtimeFormat), cinemaLocation())
+			}
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("showtime must look like 2024-01-31 19:30")
+}
+
+// parseRuntime reads a runtime in minutes, either as a plain number such as
+// "135" or as a duration such as "2h 15m", "2h" or "95m"
+func parseRuntime(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if minutes, err := strconv.Atoi(s); err == nil {
+		if minutes <= 0 {
+			return 0, fmt.Errorf("runtime must be a positive number of minutes")
+		}
+		return minutes, nil
+	}
+	if s == "" || !durationPattern.MatchString(s) {
+		return 0, fmt.Errorf("runtime must be in minutes or look like 2h 15m")
+	}
+	d, err := time.ParseDuration(strings.ReplaceAll(s, " ", ""))
+	if err != nil || d < time.Minute {
+		return 0, fmt.Errorf("runtime must be in minutes or look like 2h 15m")
+	}
+	return int(d / time.Minute), nil
+}
+
+// formatShowtime shows a timestamp in the cinema's time zone
+func formatShowtime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(cinemaLocation()).Format(showtimeDisplayFormat)
+}
+
+// formatRuntime shows minutes as "2h 28m"
+func formatRuntime(minutes int) string {
+	switch {
+	case minutes <= 0:
+		return ""
+	case minutes < 60:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes%60 == 0:
+		return fmt.Sprintf("%dh", minutes/60)
+	default:
+		return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+	}
+}
+
+// LocalTime is the showtime in the cinema's time zone
+func (m Movie) LocalTime() time.Time {
+	return m.Time.In(cinemaLocation())
+}
+
+// EndTime is when the screening finishes
+func (m Movie) EndTime() time.Time {
+	return m.LocalTime().Add(time.Duration(m.Runtime) * time.Minute)
+}
+
+// ShowtimeLabel is the showtime as entered, for forms, imports and the CLI
+func (m Movie) ShowtimeLabel() string {
+	if m.Time.IsZero() {
+		return ""
+	}
+	return m.LocalTime().Format(showtimeFormat)
+}
+
+// ShowtimeInput is the showtime as a datetime-local input value
+func (m Movie) ShowtimeInput() string {
+	if m.Time.IsZero() {
+		return ""
+	}
+	return m.LocalTime().Format(showtimeInputFormat)
+}
+
+// migrateShowtimes converts databases from before typed showtimes, which kept
+// the showtime as wall-clock text in a time column and the runtime as text
+// like "2h 28m" in a duration column, to UTC starts_at timestamps and runtime
+// minutes. The old columns are dropped once every row has been converted.
+func migrateShowtimes() error {
+	exists, err := columnExists("movies", "time")
+	if err != nil || !exists {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, time, duration FROM movies")
+	if err != nil {
+		return err
+	}
+	type converted struct {
+		id      int
+		start   time.Time
+		runtime int
+	}
+	var pending []converted
+	for rows.Next() {
+		var c converted
+		var showtime, duration string
+		if err := rows.Scan(&c.id, &showtime, &duration); err != nil {
+			rows.Close()
+			return err
+		}
+		if c.start, err = parseShowtime(showtime); err != nil {
+			log.Printf("Movie %d has an unreadable showtime %q, leaving it unset", c.id, showtime)
+		}
+		if c.runtime, err = parseRuntime(duration); err != nil {
+			log.Printf("Movie %d has an unreadable duration %q, leaving it unset", c.id, duration)
+		}
+		pending = append(pending, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range pending {
+		if _, err := tx.Exec("UPDATE movies SET starts_at = ?, runtime = ? WHERE id = ?", c.start, c.runtime, c.id); err != nil {
+			return err
+		}
+	}
+	for _, column := range []string{"time", "duration"} {
+		if _, err := tx.Exec("ALTER TABLE movies DROP COLUMN " + column); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Converted %d showtime(s) to timestamps in %s", len(pending), cinemaLocation())
+	return tx.Commit()
+}
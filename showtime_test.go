@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseShowtime(t *testing.T) {
+	loc := setCinemaZone(t, "America/New_York")
+
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"2024-01-31 19:30", time.Date(2024, 2, 1, 0, 30, 0, 0, time.UTC), true},
+		{"2024-01-31T19:30", time.Date(2024, 2, 1, 0, 30, 0, 0, time.UTC), true},
+		{" 2024-07-04 21:00 ", time.Date(2024, 7, 5, 1, 0, 0, 0, time.UTC), true},
+		{"2024-01-31 9:30", time.Date(2024, 1, 31, 14, 30, 0, 0, time.UTC), true},
+
+		// The clocks go forward at 02:00 on 10 March, so 02:30 never happens
+		{"2024-03-10 01:59", time.Date(2024, 3, 10, 6, 59, 0, 0, time.UTC), true},
+		{"2024-03-10 02:30", time.Time{}, false},
+		{"2024-03-10T02:00", time.Time{}, false},
+		{"2024-03-10 03:00", time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC), true},
+
+		// 01:30 on 3 November happens twice and means the first one
+		{"2024-11-03 01:30", time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), true},
+
+		{"", time.Time{}, false},
+		{"2024-01-31", time.Time{}, false},
+		{"31/01/2024 19:30", time.Time{}, false},
+		{"2024-01-31 25:00", time.Time{}, false},
+		{"2024-02-30 19:30", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseShowtime(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseShowtime(%q) error = %v, want ok = %v", tt.in, err, tt.ok)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseShowtime(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+		if tt.ok && got.Location() != time.UTC {
+			t.Errorf("parseShowtime(%q) is in %v, want UTC", tt.in, got.Location())
+		}
+	}
+
+	// Showtimes read back as entered
+	for _, in := range []string{"2024-01-31 19:30", "2024-03-10 03:00", "2024-11-03 01:30"} {
+		showtime, _ := parseShowtime(in)
+		if got := (Movie{Time: showtime}).ShowtimeLabel(); got != in {
+			t.Errorf("ShowtimeLabel of %q = %q in %v", in, got, loc)
+		}
+	}
+}
+
+func TestParseRuntime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"148", 148, true},
+		{" 90 ", 90, true},
+		{"2h 28m", 148, true},
+		{"2h28m", 148, true},
+		{"2h", 120, true},
+		{"95m", 95, true},
+		{"1h 75m", 135, true},
+		{"0", 0, false},
+		{"-5", 0, false},
+		{"0m", 0, false},
+		{"", 0, false},
+		{"2 hours", 0, false},
+		{"2h 28", 0, false},
+		{"90s", 0, false},
+		{"1.5h", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRuntime(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseRuntime(%q) error = %v, want ok = %v", tt.in, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseRuntime(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	// formatRuntime is the inverse for positive runtimes
+	for _, minutes := range []int{45, 60, 148} {
+		if got, err := parseRuntime(formatRuntime(minutes)); err != nil || got != minutes {
+			t.Errorf("parseRuntime(formatRuntime(%d)) = %d, %v", minutes, got, err)
+		}
+	}
+}
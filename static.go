@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// staticFiles holds the stylesheet and bundled images, so the binary can run
+// from any directory
+//
+//go:embed static
+var staticFiles embed.FS
+
+// staticAsset is an embedded file with its content hash
+type staticAsset struct {
+	name string
+	hash string
+	data []byte
+}
+
+// staticAssets indexes the embedded files by name and by hashed name
+var staticAssets, hashedAssets = loadStaticAssets()
+
+// loadStaticAssets reads every embedded file and works out its hashed name
+func loadStaticAssets() (map[string]*staticAsset, map[string]*staticAsset) {
+	byName := make(map[string]*staticAsset)
+	byHash := make(map[string]*staticAsset)
+	err := fs.WalkDir(staticFiles, "static", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := staticFiles.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		asset := &staticAsset{
+			name: strings.TrimPrefix(p, "static/"),
+			hash: hex.EncodeToString(sum[:8]),
+			data: data,
+		}
+		byName[asset.name] = asset
+		byHash[hashedName(asset.name, asset.hash)] = asset
+		return nil
+	})
+	if err != nil {
+		panic("loading embedded static files: " + err.Error())
+	}
+	return byName, byHash
+}
+
+// hashedName puts the content hash before the extension, so styles.css
+// becomes styles.1a2b3c4d5e6f7a8b.css
+func hashedName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// staticURL is the content-hashed URL of an embedded file. The URL changes
+// whenever the file does, so browsers can cache it for good.
+func staticURL(name string) string {
+	if asset, ok := staticAssets[name]; ok {
+		return "/static/" + hashedName(asset.name, asset.hash)
+	}
+	return "/static/" + name
+}
+
+// staticHandler serves embedded files. Hashed URLs are cached for a year;
+// plain names, such as image paths stored with older movies, are revalidated
+// with their ETag.
+func staticHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	cache := "public, max-age=31536000, immutable"
+	asset, ok := hashedAssets[name]
+	if !ok {
+		asset, ok = staticAssets[name]
+		cache = "no-cache"
+	}
+	if !ok {
+		notFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", cache)
+	w.Header().Set("ETag", `"`+asset.hash+`"`)
+	http.ServeContent(w, r, asset.name, time.Time{}, bytes.NewReader(asset.data))
+}
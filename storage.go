@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AssetStore keeps uploaded files, such as poster renditions, somewhere every
+// instance of the site can serve them from. Keys are slash-separated paths
+// like "posters/movie_1_ab12_card.jpg".
+type AssetStore interface {
+	// Put stores the data under key, replacing anything already there
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Delete removes the key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL is the address browsers load the key from
+	URL(key string) string
+}
+
+// assets is where uploads are stored, set up by initAssetStore
+var assets AssetStore
+
+// uploadDir is where the local store keeps uploads, next to the database
+var uploadDir = filepath.Join("data", "uploads")
+
+// initAssetStore picks the storage backend from MOOBEE_STORAGE: "local"
+// (the default) keeps files under data/uploads, "s3" uses an S3-compatible
+// bucket configured by the MOOBEE_S3_* variables
+func initAssetStore() error {
+	switch backend := envOr("MOOBEE_STORAGE", "local"); backend {
+	case "local":
+		if err := migrateLocalUploads(); err != nil {
+			return fmt.Errorf("moving uploads to %s: %w", uploadDir, err)
+		}
+		assets = &LocalStore{Dir: uploadDir, BaseURL: "/uploads"}
+	case "s3":
+		store, err := newS3StoreFromEnv()
+		if err != nil {
+			return err
+		}
+		assets = store
+		log.Printf("Storing uploads in bucket %s at %s", store.Bucket, store.Endpoint)
+	default:
+		return fmt.Errorf("unknown MOOBEE_STORAGE %q, expected local or s3", backend)
+	}
+	return nil
+}
+
+// LocalStore keeps assets in a directory served by the site itself. It only
+// suits a single instance, or several sharing one filesystem.
+type LocalStore struct {
+	Dir     string
+	BaseURL string
+}
+
+// path maps a key to a file inside the store's directory
+func (s *LocalStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)[1:]
+	if clean == "" || clean != key {
+		return "", fmt.Errorf("invalid asset key %q", key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.BaseURL + "/" + key
+}
+
+// uploadsHandler serves files kept by the local store. Upload keys contain a
+// content hash, so they can be cached for good.
+func uploadsHandler() http.Handler {
+	files := http.FileServer(http.Dir(uploadDir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+			notFound(w, r)
+			return
+		}
+		// Check first so a missing upload gets the error page rather than
+		// the file server's plain-text 404
+		info, err := os.Stat(filepath.Join(uploadDir, filepath.FromSlash(path.Clean("/"+r.URL.Path))))
+		if err != nil || info.IsDir() {
+			notFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// migrateLocalUploads moves posters uploaded when the local store wrote into
+// static/images, which is now embedded in the binary rather than served from
+// disk, and points their movies at the new location
+func migrateLocalUploads() error {
+	oldDir := filepath.Join("static", "images", "posters")
+	entries, err := os.ReadDir(oldDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	newDir := filepath.Join(uploadDir, "posters")
+	if err := os.MkdirAll(newDir, 0o755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.Rename(filepath.Join(oldDir, entry.Name()), filepath.Join(newDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(oldDir); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"UPDATE movies SET image = '/uploads/posters/' || substr(image, 24) WHERE image LIKE '/static/images/posters/%'",
+	)
+	if err == nil {
+		log.Printf("Moved %d uploaded poster file(s) to %s", len(entries), newDir)
+	}
+	return err
+}
+
+// S3Store keeps assets in a bucket of any S3-compatible service, such as AWS
+// S3, MinIO or Cloudflare R2. Requests are signed with AWS Signature
+// Version 4; objects must be publicly readable, directly or through PublicURL.
+type S3Store struct {
+	Endpoint  string // e.g. https://s3.eu-west-2.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PublicURL is where browsers load objects from, such as a CDN. It
+	// defaults to the object's address at the endpoint.
+	PublicURL string
+	// PathStyle addresses objects as endpoint/bucket/key rather than
+	// bucket.endpoint/key, as MinIO and most self-hosted services expect
+	PathStyle bool
+
+	Client *http.Client
+}
+
+// newS3StoreFromEnv configures an S3Store from the MOOBEE_S3_* variables.
+// Without MOOBEE_S3_ENDPOINT it talks to AWS in the configured region.
+func newS3StoreFromEnv() (*S3Store, error) {
+	s := &S3Store{
+		Endpoint:  strings.TrimRight(envOr("MOOBEE_S3_ENDPOINT", ""), "/"),
+		Region:    envOr("MOOBEE_S3_REGION", "us-east-1"),
+		Bucket:    envOr("MOOBEE_S3_BUCKET", ""),
+		AccessKey: envOr("MOOBEE_S3_ACCESS_KEY", ""),
+		SecretKey: envOr("MOOBEE_S3_SECRET_KEY", ""),
+		PublicURL: strings.TrimRight(envOr("MOOBEE_S3_PUBLIC_URL", ""), "/"),
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("MOOBEE_STORAGE=s3 needs MOOBEE_S3_BUCKET, MOOBEE_S3_ACCESS_KEY and MOOBEE_S3_SECRET_KEY")
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.Region)
+	} else {
+		s.PathStyle = envOr("MOOBEE_S3_PATH_STYLE", "true") == "true"
+	}
+	if _, err := url.Parse(s.Endpoint); err != nil {
+		return nil, fmt.Errorf("invalid MOOBEE_S3_ENDPOINT: %v", err)
+	}
+	return s, nil
+}
+
+// objectURL is the object's address at the endpoint
+func (s *S3Store) objectURL(key string) string {
+	u, _ := url.Parse(s.Endpoint)
+	if s.PathStyle {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + key
+	}
+	return u.String()
+}
+
+func (s *S3Store) Put(ctx context.Context, key, contentType string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	// Keys include a content hash, so browsers can keep them for good
+	req.Header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	return s.do(req, data)
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	return s.do(req, nil)
+}
+
+func (s *S3Store) URL(key string) string {
+	if s.PublicURL != "" {
+		return s.PublicURL + "/" + key
+	}
+	return s.objectURL(key)
+}
+
+// do signs and sends the request, turning S3 error responses into errors
+func (s *S3Store) do(req *http.Request, payload []byte) error {
+	sum := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	signV4(req, hex.EncodeToString(sum[:]), s.AccessKey, s.SecretKey, s.Region, "s3", time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("storage: %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// signV4 adds AWS Signature Version 4 headers to the request, signing the
+// host and every header already set on it
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// Canonical headers: lower-case names, sorted, with trimmed values
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalPath := awsURIEncode(req.URL.Path, false)
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery sorts and encodes query parameters the way SigV4 expects
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsURIEncode(name, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsURIEncode percent-encodes everything except unreserved characters, and
+// slashes too when encodeSlash is set
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestPagesRender requests every page through its handler, so each template
+// runs with the data its handler really passes, layout and partials included
+func TestPagesRender(t *testing.T) {
+	site := newTestSite(t)
+	rendered := map[string]bool{}
+
+	check := func(page, method, target string, form url.Values, status int, cookies ...*http.Cookie) {
+		t.Helper()
+		w := request(site, method, target, form, cookies...)
+		if w.Code != status {
+			t.Errorf("%s %s: status %d, want %d\n%s", method, target, w.Code, status, w.Body.String())
+			return
+		}
+		if !strings.Contains(w.Body.String(), "</html>") {
+			t.Errorf("%s %s: response is not a whole page", method, target)
+		}
+		rendered[page] = true
+	}
+
+	// Before there is an admin, only the setup wizard is served
+	check("setup", "GET", "/setup", nil, http.StatusOK)
+	check("setup", "POST", "/setup", url.Values{"token": {"wrong"}, "name": {"A"}, "email": {"a@example.com"}}, http.StatusOK)
+
+	admin := createTestUser(t, "admin@example.com", true, false)
+	customer := createTestUser(t, "customer@example.com", false, false)
+	adminCookie := sessionCookie(t, admin)
+	customerCookie := sessionCookie(t, customer)
+
+	movie := createTestMovie(t, "Render Test")
+	bookingID := createTestBooking(t, movie.ID, customer)
+	shiftID, err := startShift(admin.ID, 10000, "USD")
+	if err != nil {
+		t.Fatalf("startShift: %v", err)
+	}
+
+	check("landing", "GET", "/", nil, http.StatusOK)
+	check("login", "GET", "/login", nil, http.StatusOK)
+	check("register", "GET", "/register", nil, http.StatusOK)
+	check("home", "GET", "/home", nil, http.StatusOK)
+	check("search", "GET", "/search?q=render", nil, http.StatusOK)
+	check("book", "GET", fmt.Sprintf("/book/%d", movie.ID), nil, http.StatusOK)
+	check("error", "GET", "/no-such-page", nil, http.StatusNotFound)
+
+	twoFactor := createTestUser(t, "2fa@example.com", false, false)
+	enableTestTOTP(t, twoFactor)
+	pending, err := createSession(twoFactor.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pendingCookie := &http.Cookie{Name: "session", Value: pending}
+	check("login_2fa", "GET", "/login/2fa", nil, http.StatusOK, pendingCookie)
+	check("login_2fa", "POST", "/login/2fa", url.Values{"code": {"000000"}}, http.StatusOK, pendingCookie)
+
+	check("bookings", "GET", "/bookings", nil, http.StatusOK, customerCookie)
+	check("view_booking", "GET", fmt.Sprintf("/booking/%d", bookingID), nil, http.StatusOK, customerCookie)
+	check("profile", "GET", "/profile", nil, http.StatusOK, customerCookie)
+
+	check("admin", "GET", "/admin", nil, http.StatusOK, adminCookie)
+	check("admin_movies", "GET", "/admin/movies", nil, http.StatusOK, adminCookie)
+	check("admin_import", "GET", "/admin/movies/import", nil, http.StatusOK, adminCookie)
+	check("admin_seats", "GET", fmt.Sprintf("/admin/movies/seats/%d", movie.ID), nil, http.StatusOK, adminCookie)
+	check("admin_bookings", "GET", "/admin/bookings", nil, http.StatusOK, adminCookie)
+	check("admin_reports", "GET", "/admin/reports", nil, http.StatusOK, adminCookie)
+	check("admin_audit", "GET", "/admin/audit", nil, http.StatusOK, adminCookie)
+	check("admin_brands", "GET", "/admin/brands", nil, http.StatusOK, adminCookie)
+	check("admin_users", "GET", "/admin/users", nil, http.StatusOK, adminCookie)
+	check("admin_user", "GET", fmt.Sprintf("/admin/users/%d", customer.ID), nil, http.StatusOK, adminCookie)
+
+	check("pos", "GET", "/pos", nil, http.StatusOK, adminCookie)
+	check("pos_sell", "GET", fmt.Sprintf("/pos/sell/%d", movie.ID), nil, http.StatusOK, adminCookie)
+	check("pos_tickets", "GET", fmt.Sprintf("/pos/tickets/%d", bookingID), nil, http.StatusOK, adminCookie)
+	check("pos_shift", "GET", fmt.Sprintf("/pos/shift/%d", shiftID), nil, http.StatusOK, adminCookie)
+
+	// New pages need a request above too
+	entries, err := fs.ReadDir(templateFiles, templateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		page, ok := strings.CutSuffix(e.Name(), ".html")
+		if e.IsDir() || !ok || page == "layout" {
+			continue
+		}
+		if !rendered[page] {
+			t.Errorf("page %s was not rendered by any request in this test", page)
+		}
+	}
+}
+
+func TestAdminMoviesCapitalisesErrors(t *testing.T) {
+	newTestSite(t)
+	admin := createTestUser(t, "admin@example.com", true, false)
+
+	for msg, want := range map[string]string{
+		"":                   "",
+		"éclair is sold out": "Éclair is sold out",
+		"x":                  "X",
+	} {
+		r := httptest.NewRequest("GET", "/admin/movies", nil)
+		r.AddCookie(sessionCookie(t, admin))
+		w := httptest.NewRecorder()
+		renderAdminMovies(w, r, Movie{}, errors.New(msg))
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: status %d", msg, w.Code)
+		}
+		if want != "" && !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%q: page does not show %q", msg, want)
+		}
+	}
+}
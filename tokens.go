@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// API token scopes
+const (
+	scopeBookingsRead  = "bookings:read"
+	scopeBookingsWrite = "bookings:write"
+	scopeMoviesWrite   = "movies:write"
+)
+
+const apiTokenPrefix = "mb_"
+
+// APIScope describes a permission that can be granted to an API token
+type APIScope struct {
+	Name        string
+	Description string
+	AdminOnly   bool
+}
+
+var apiScopes = []APIScope{
+	{Name: scopeBookingsRead, Description: "Read bookings"},
+	{Name: scopeBookingsWrite, Description: "Make bookings"},
+	{Name: scopeMoviesWrite, Description: "Manage movies", AdminOnly: true},
+}
+
+// APIToken is a personal access token as listed on the profile page
+type APIToken struct {
+	ID          int
+	UserID      int
+	UserEmail   string
+	Name        string
+	Scopes      []string
+	DateCreated time.Time
+	LastUsed    *time.Time
+}
+
+type contextKey string
+
+const (
+	userContextKey   contextKey = "user"
+	scopesContextKey contextKey = "scopes"
+)
+
+var errInvalidToken = errors.New("invalid API token")
+
+// hashToken returns the value stored in the database for a random secret
+// token. Tokens are long, so a plain SHA-256 is enough and keeps lookups indexed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// allowedScopes filters requested scopes down to those the user may grant
+func allowedScopes(user User, requested []string) []string {
+	var scopes []string
+	for _, scope := range apiScopes {
+		if scope.AdminOnly && !user.IsAdmin {
+			continue
+		}
+		for _, r := range requested {
+			if r == scope.Name {
+				scopes = append(scopes, scope.Name)
+				break
+			}
+		}
+	}
+	return scopes
+}
+
+// createAPIToken issues a new token for the user and returns its plain-text
+// value, which is only shown once, along with the token for the audit log
+func createAPIToken(user User, name string, requested []string) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", APIToken{}, errors.New("token name is required")
+	}
+
+	scopes := allowedScopes(user, requested)
+	if len(scopes) == 0 {
+		return "", APIToken{}, errors.New("select at least one permission")
+	}
+
+	random, err := generateToken()
+	if err != nil {
+		return "", APIToken{}, err
+	}
+	token := apiTokenPrefix + strings.TrimRight(random, "=")
+
+	result, err := db.Exec(
+		"INSERT INTO api_tokens (user_id, name, token_hash, scopes) VALUES (?, ?, ?, ?)",
+		user.ID, name, hashToken(token), strings.Join(scopes, " "),
+	)
+	if err != nil {
+		return "", APIToken{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return "", APIToken{}, err
+	}
+
+	return token, APIToken{ID: int(id), UserID: user.ID, UserEmail: user.Email, Name: name, Scopes: scopes}, nil
+}
+
+// revokeAPIToken revokes one of the user's tokens. Admins may revoke any
+// token. It returns the revoked token, with its owner, for the audit log.
+func revokeAPIToken(user User, tokenID int) (APIToken, error) {
+	var t APIToken
+	var scopes string
+	err := db.QueryRow(`
+        SELECT t.id, t.user_id, u.email, t.name, t.scopes, t.date_created
+        FROM api_tokens t
+        JOIN users u ON u.id = t.user_id
+        WHERE t.id = ? AND t.revoked_at IS NULL`,
+		tokenID,
+	).Scan(&t.ID, &t.UserID, &t.UserEmail, &t.Name, &scopes, &t.DateCreated)
+	if err == sql.ErrNoRows || (err == nil && t.UserID != user.ID && !user.IsAdmin) {
+		return APIToken{}, errors.New("token not found")
+	} else if err != nil {
+		return APIToken{}, err
+	}
+	t.Scopes = strings.Fields(scopes)
+
+	_, err = db.Exec("UPDATE api_tokens SET revoked_at = ? WHERE id = ?", time.Now(), tokenID)
+	if err != nil {
+		return APIToken{}, err
+	}
+	return t, nil
+}
+
+// listAPITokens returns active tokens, for one user or for everyone when userID is 0
+func listAPITokens(userID int) ([]APIToken, error) {
+	query := `
+        SELECT t.id, t.user_id, u.email, t.name, t.scopes, t.date_created, t.last_used_at
+        FROM api_tokens t
+        JOIN users u ON u.id = t.user_id
+        WHERE t.revoked_at IS NULL`
+	var args []interface{}
+	if userID != 0 {
+		query += " AND t.user_id = ?"
+		args = append(args, userID)
+	}
+	query += " ORDER BY t.date_created DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.UserID, &t.UserEmail, &t.Name, &scopes, &t.DateCreated, &lastUsed); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Fields(scopes)
+		if lastUsed.Valid {
+			t.LastUsed = &lastUsed.Time
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// getUserFromAPIToken authenticates an Authorization: Bearer header and
+// returns the token owner and the scopes granted to the token
+func getUserFromAPIToken(r *http.Request) (User, []string, error) {
+	header := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || !strings.HasPrefix(token, apiTokenPrefix) {
+		return User{}, nil, errInvalidToken
+	}
+
+	var tokenID, userID int
+	var scopes string
+	err := db.QueryRow(
+		"SELECT id, user_id, scopes FROM api_tokens WHERE token_hash = ? AND revoked_at IS NULL",
+		hashToken(strings.TrimSpace(token)),
+	).Scan(&tokenID, &userID, &scopes)
+	if err != nil {
+		return User{}, nil, errInvalidToken
+	}
+
+	user, err := getUser(userID)
+	if err != nil || user.Disabled {
+		return User{}, nil, errInvalidToken
+	}
+
+	db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", time.Now(), tokenID)
+
+	// Scopes can't outlive the rights of the user who created the token
+	return user, allowedScopes(user, strings.Fields(scopes)), nil
+}
+
+// authenticateRequest accepts either a bearer token or a session cookie.
+// Browser sessions carry every scope the user's role allows.
+func authenticateRequest(r *http.Request) (User, []string, error) {
+	if r.Header.Get("Authorization") != "" {
+		return getUserFromAPIToken(r)
+	}
+
+	user, err := getUserFromSession(r)
+	if err != nil {
+		return User{}, nil, err
+	}
+
+	var all []string
+	for _, scope := range apiScopes {
+		all = append(all, scope.Name)
+	}
+	return user, allowedScopes(user, all), nil
+}
+
+// withUser stores the authenticated user and scopes on the request context
+func withUser(r *http.Request, user User, scopes []string) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	ctx = context.WithValue(ctx, scopesContextKey, scopes)
+	return r.WithContext(ctx)
+}
+
+// requestUser returns the user stored by the auth middleware
+func requestUser(r *http.Request) (User, bool) {
+	user, ok := r.Context().Value(userContextKey).(User)
+	return user, ok
+}
+
+// hasScope reports whether the authenticated request was granted scope
+func hasScope(r *http.Request, scope string) bool {
+	scopes, _ := r.Context().Value(scopesContextKey).([]string)
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// apiMiddleware authenticates API requests by bearer token or session and
+// rejects them unless they carry the required scope
+func apiMiddleware(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, scopes, err := authenticateRequest(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="moobee"`)
+			writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		r = withUser(r, user, scopes)
+		if !hasScope(r, scope) {
+			writeJSONError(w, http.StatusForbidden, "Token is missing the "+scope+" permission")
+			return
+		}
+
+		// The admin 2FA policy covers admin permissions however they're used
+		if isAdminScope(scope) && !user.TOTPEnabled && adminRequires2FA() {
+			writeJSONError(w, http.StatusForbidden, "Two-factor authentication is required for the "+scope+" permission")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// guestAPIMiddleware is apiMiddleware for endpoints that also serve
+// visitors who aren't signed in: requests without a token or session pass
+// through without a user
+func guestAPIMiddleware(scope string, next http.HandlerFunc) http.HandlerFunc {
+	authenticated := apiMiddleware(scope, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			if _, err := getUserFromSession(r); err != nil {
+				next(w, r)
+				return
+			}
+		}
+		authenticated(w, r)
+	}
+}
+
+// isAdminScope reports whether scope can only be granted to admins
+func isAdminScope(scope string) bool {
+	for _, s := range apiScopes {
+		if s.Name == scope {
+			return s.AdminOnly
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// apiRequest sends a JSON request with the token as a bearer token
+func apiRequest(h http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func createTestToken(t *testing.T, user User, scopes ...string) string {
+	t.Helper()
+	token, _, err := createAPIToken(user, "test", scopes)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+	return token
+}
+
+func TestAPIBookWithToken(t *testing.T) {
+	site := newTestSite(t)
+	createTestUser(t, "admin@example.com", true, false)
+	customer := createTestUser(t, "customer@example.com", false, false)
+	movie := createTestMovie(t, "Token Matinee")
+
+	book := func(token, seat string) *httptest.ResponseRecorder {
+		body := `{"name":"Someone","email":"someone@example.com","movieID":` + strconv.Itoa(movie.ID) + `,"seats":["` + seat + `"]}`
+		return apiRequest(site, http.MethodPost, "/api/book", token, body)
+	}
+	bookingOwner := func(w *httptest.ResponseRecorder) sql.NullInt64 {
+		t.Helper()
+		var resp BookingResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || !resp.Success {
+			t.Fatalf("booking failed: %d %s", w.Code, w.Body)
+		}
+		var owner sql.NullInt64
+		if err := db.QueryRow("SELECT user_id FROM bookings WHERE id = ?", resp.BookingID).Scan(&owner); err != nil {
+			t.Fatal(err)
+		}
+		return owner
+	}
+
+	token := createTestToken(t, customer, scopeBookingsWrite)
+	if owner := bookingOwner(book(token, seatID(0, 0))); owner.Int64 != int64(customer.ID) {
+		t.Errorf("token booking belongs to %v, want user %d", owner, customer.ID)
+	}
+
+	if owner := bookingOwner(book("", seatID(0, 1))); owner.Valid {
+		t.Errorf("guest booking belongs to user %d", owner.Int64)
+	}
+
+	if w := book("mb_not-a-token", seatID(0, 2)); w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid token: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	readOnly := createTestToken(t, customer, scopeBookingsRead)
+	if w := book(readOnly, seatID(0, 2)); w.Code != http.StatusForbidden {
+		t.Errorf("token without %s: got %d, want %d", scopeBookingsWrite, w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAPIAdminScopeRequires2FA(t *testing.T) {
+	site := newTestSite(t)
+	admin := createTestUser(t, "admin@example.com", true, false)
+	token := createTestToken(t, admin, scopeMoviesWrite)
+	if err := setSetting(settingRequireAdmin2FA, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	first := createTestMovie(t, "First Feature")
+	w := apiRequest(site, http.MethodDelete, "/api/movies/"+strconv.Itoa(first.ID), token, "")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("admin without 2FA: got %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if getMovie(first.ID) == nil {
+		t.Fatal("movie was deleted without 2FA")
+	}
+
+	// Sessions are held to the same policy
+	w = request(site, http.MethodDelete, "/api/movies/"+strconv.Itoa(first.ID), nil, sessionCookie(t, admin))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("admin session without 2FA: got %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	enableTestTOTP(t, admin)
+	w = apiRequest(site, http.MethodDelete, "/api/movies/"+strconv.Itoa(first.ID), token, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("admin with 2FA: got %d %s, want %d", w.Code, w.Body, http.StatusNoContent)
+	}
+}
+
+func TestBookPagePrefillsSignedInUser(t *testing.T) {
+	site := newTestSite(t)
+	createTestUser(t, "admin@example.com", true, false)
+	customer := createTestUser(t, "customer@example.com", false, false)
+	movie := createTestMovie(t, "Prefill Matinee")
+
+	w := request(site, "GET", "/book/"+strconv.Itoa(movie.ID), nil, sessionCookie(t, customer))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `value="customer@example.com"`) {
+		t.Error("the booking form is not filled in for the signed-in customer")
+	}
+}
+
+func TestTokenCreationIsAudited(t *testing.T) {
+	site := newTestSite(t)
+	admin := createTestUser(t, "admin@example.com", true, false)
+
+	form := url.Values{"action": {"create"}, "name": {"deploy"}, "scopes": {scopeMoviesWrite}}
+	if w := request(site, "POST", "/profile/tokens", form, sessionCookie(t, admin)); w.Code != http.StatusOK {
+		t.Fatalf("creating a token: status %d", w.Code)
+	}
+
+	var id int
+	if err := db.QueryRow("SELECT id FROM api_tokens WHERE user_id = ? AND name = 'deploy'", admin.ID).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	var actor, after string
+	err := db.QueryRow("SELECT user_email, after FROM audit_log WHERE action = 'token.create' AND target_id = ?", strconv.Itoa(id)).Scan(&actor, &after)
+	if err != nil {
+		t.Fatalf("no audit entry for the new token: %v", err)
+	}
+	if actor != admin.Email || !strings.Contains(after, scopeMoviesWrite) {
+		t.Errorf("audit entry by %s with %s", actor, after)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer        = "Moobee"
+	totpDigits        = 6
+	totpPeriod        = 30 * time.Second
+	totpSkew          = 1 // accept codes one period either side of now
+	recoveryCodeCount = 10
+	maxMFAAttempts    = 5 // wrong codes before a pending sign-in is abandoned
+
+	// settingRequireAdmin2FA is the settings key for the admin 2FA policy
+	settingRequireAdmin2FA = "require_admin_2fa"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret returns a new random base32-encoded shared secret
+func generateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// totpCode computes the RFC 6238 code for secret at the given time step
+func totpCode(secret string, counter uint64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// validateTOTP reports whether code is valid for secret at time t
+func validateTOTP(secret, code string, t time.Time) bool {
+	_, ok := matchTOTP(secret, code, t)
+	return ok
+}
+
+// matchTOTP checks code against the time steps around t and returns the
+// step it belongs to, so that an accepted code can't be used again
+func matchTOTP(secret, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	counter := t.Unix() / int64(totpPeriod/time.Second)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		expected, err := totpCode(secret, uint64(counter+int64(i)))
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return counter + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// totpURI builds the otpauth:// URI understood by authenticator apps
+func totpURI(accountName, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + accountName)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(int(totpPeriod/time.Second)))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// totpQRCode renders the enrollment URI as a PNG data URL for the profile page.
+// It is typed as a template.URL because html/template rejects data: URLs in
+// plain strings.
+func totpQRCode(accountName, secret string) (template.URL, error) {
+	return qrDataURL(totpURI(accountName, secret), 220)
+}
+
+var errTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// startTOTPEnrollment stores a fresh, not yet enabled secret for the user.
+// Accounts that already use 2FA keep their secret; they have to disable it,
+// with a code, before enrolling again.
+func startTOTPEnrollment(userID int) (string, error) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	res, err := db.Exec(
+		"UPDATE users SET totp_secret = ? WHERE id = ? AND totp_enabled = 0",
+		secret, userID,
+	)
+	if err != nil {
+		return "", err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return "", err
+	} else if n == 0 {
+		return "", errTOTPAlreadyEnabled
+	}
+
+	return secret, nil
+}
+
+// enableTOTP verifies the first code from the authenticator app, turns on
+// two-factor authentication and returns a new set of recovery codes
+func enableTOTP(userID int, code string) ([]string, error) {
+	var secret string
+	var enabled bool
+	err := db.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = ?", userID).Scan(&secret, &enabled)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabled {
+		return nil, errTOTPAlreadyEnabled
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("two-factor setup has not been started")
+	}
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("invalid authentication code")
+	}
+
+	// The enrollment code counts as used, so it can't also sign in
+	if _, err := db.Exec("UPDATE users SET totp_enabled = 1, totp_last_step = ? WHERE id = ?", step, userID); err != nil {
+		return nil, err
+	}
+
+	return regenerateRecoveryCodes(userID)
+}
+
+// disableTOTP turns off two-factor authentication and discards the secret
+// and any remaining recovery codes
+func disableTOTP(userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_secret = '', totp_enabled = 0 WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// regenerateRecoveryCodes replaces the user's recovery codes and returns the
+// plain-text codes, which are only ever shown once
+func regenerateRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = string(hash)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	for _, hash := range hashes {
+		_, err := tx.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, hash,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// useRecoveryCode consumes a matching unused recovery code for the user
+func useRecoveryCode(userID int, code string) bool {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if code == "" {
+		return false
+	}
+
+	rows, err := db.Query(
+		"SELECT id, code_hash FROM recovery_codes WHERE user_id = ? AND used_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return false
+	}
+
+	matchID := 0
+	for rows.Next() {
+		var id int
+		var hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			continue
+		}
+		if comparePasswords(hash, code) {
+			matchID = id
+			break
+		}
+	}
+	rows.Close()
+
+	if matchID == 0 {
+		return false
+	}
+
+	result, err := db.Exec(
+		"UPDATE recovery_codes SET used_at = ? WHERE id = ? AND used_at IS NULL",
+		time.Now(), matchID,
+	)
+	if err != nil {
+		return false
+	}
+	n, err := result.RowsAffected()
+	return err == nil && n == 1
+}
+
+// remainingRecoveryCodes returns how many unused recovery codes the user has
+func remainingRecoveryCodes(userID int) int {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL",
+		userID,
+	).Scan(&count)
+	if err != nil && err != sql.ErrNoRows {
+		return 0
+	}
+	return count
+}
+
+// verifySecondFactor accepts either a current TOTP code that hasn't been used
+// before or an unused recovery code
+func verifySecondFactor(userID int, code string) bool {
+	var secret string
+	var enabled bool
+	err := db.QueryRow(
+		"SELECT totp_secret, totp_enabled FROM users WHERE id = ?",
+		userID,
+	).Scan(&secret, &enabled)
+	if err != nil || !enabled {
+		return false
+	}
+
+	if step, ok := matchTOTP(secret, code, time.Now()); ok {
+		// Accept each time step once, so an observed code can't be replayed
+		result, err := db.Exec(
+			"UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?",
+			step, userID, step,
+		)
+		if err != nil {
+			return false
+		}
+		n, err := result.RowsAffected()
+		return err == nil && n == 1
+	}
+	return useRecoveryCode(userID, code)
+}
+
+// adminRequires2FA reports whether the admin 2FA policy is switched on
+func adminRequires2FA() bool {
+	return getSetting(settingRequireAdmin2FA, "0") == "1"
+}
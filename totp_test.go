@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// lastStepCode is the user's TOTP code for the time step offset from the
+// last one accepted, which is within the accepted window for -1 to +1
+func lastStepCode(t *testing.T, user User, secret string, offset int64) string {
+	t.Helper()
+	var step int64
+	if err := db.QueryRow("SELECT totp_last_step FROM users WHERE id = ?", user.ID).Scan(&step); err != nil {
+		t.Fatal(err)
+	}
+	code, err := totpCode(secret, uint64(step+offset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPCodeCannotBeReplayed(t *testing.T) {
+	newTestSite(t)
+	user := createTestUser(t, "replay@example.com", false, false)
+	secret := enableTestTOTP(t, user)
+
+	enrollment := lastStepCode(t, user, secret, 0)
+	if verifySecondFactor(user.ID, enrollment) {
+		t.Error("the code used to enable 2FA was accepted again")
+	}
+
+	next := lastStepCode(t, user, secret, 1)
+	if !verifySecondFactor(user.ID, next) {
+		t.Fatal("a fresh code was rejected")
+	}
+	if verifySecondFactor(user.ID, next) {
+		t.Error("a code was accepted twice")
+	}
+	if verifySecondFactor(user.ID, enrollment) {
+		t.Error("a code from an earlier time step was accepted after a later one")
+	}
+}
+
+func TestMFAAttemptsAreLimited(t *testing.T) {
+	site := newTestSite(t)
+	createTestUser(t, "admin@example.com", true, false)
+	user := createTestUser(t, "guess@example.com", false, false)
+	secret := enableTestTOTP(t, user)
+
+	token, err := createSession(user.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := &http.Cookie{Name: "session", Value: token}
+
+	for i := 1; i <= maxMFAAttempts; i++ {
+		w := request(site, "POST", "/login/2fa", url.Values{"code": {"000000"}}, pending)
+		if w.Code != http.StatusOK {
+			t.Fatalf("attempt %d: status %d", i, w.Code)
+		}
+		locked := strings.Contains(w.Body.String(), "Too many wrong codes")
+		if locked != (i == maxMFAAttempts) {
+			t.Fatalf("attempt %d: locked = %v", i, locked)
+		}
+	}
+
+	// Even the right code is too late now
+	w := request(site, "POST", "/login/2fa", url.Values{"code": {lastStepCode(t, user, secret, 1)}}, pending)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+		t.Errorf("after the limit: status %d to %q, want a redirect to /login", w.Code, w.Header().Get("Location"))
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM sessions WHERE user_id = ?", user.ID).Scan(&count)
+	if count != 0 {
+		t.Errorf("%d sessions left after the limit, want 0", count)
+	}
+}
+
+func TestTOTPSetupKeepsEnrolledSecret(t *testing.T) {
+	site := newTestSite(t)
+	createTestUser(t, "admin@example.com", true, false)
+	user := createTestUser(t, "enrolled@example.com", false, false)
+	secret := enableTestTOTP(t, user)
+
+	w := request(site, "POST", "/profile/2fa", url.Values{"action": {"setup"}}, sessionCookie(t, user))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "already enabled") {
+		t.Errorf("setup while enrolled: status %d, want the profile with an error", w.Code)
+	}
+
+	after, err := getUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.TOTPEnabled {
+		t.Fatal("setup turned two-factor authentication off")
+	}
+	if !verifySecondFactor(user.ID, lastStepCode(t, user, secret, 1)) {
+		t.Error("setup replaced the enrolled secret")
+	}
+}
+
+func TestAdminCommandResetsTOTP(t *testing.T) {
+	newTestSite(t)
+	admin := createTestUser(t, "admin@example.com", true, false)
+	enableTestTOTP(t, admin)
+
+	if err := adminCommand([]string{"-email", admin.Email, "-password", "a-new-password"}, strings.NewReader("")); err != nil {
+		t.Fatalf("adminCommand: %v", err)
+	}
+
+	after, err := getUser(admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.TOTPEnabled {
+		t.Error("two-factor authentication is still enabled after the reset")
+	}
+	var secret string
+	var codes int
+	if err := db.QueryRow("SELECT totp_secret FROM users WHERE id = ?", admin.ID).Scan(&secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?", admin.ID).Scan(&codes); err != nil {
+		t.Fatal(err)
+	}
+	if secret != "" || codes != 0 {
+		t.Errorf("reset left secret %q and %d recovery codes", secret, codes)
+	}
+
+	var before, afterJSON string
+	err = db.QueryRow("SELECT before, after FROM audit_log WHERE action = 'user.admin_reset' AND target_id = ?", admin.ID).Scan(&before, &afterJSON)
+	if err != nil {
+		t.Fatalf("no audit entry for the reset: %v", err)
+	}
+	if !strings.Contains(before, `"two_factor":true`) || !strings.Contains(afterJSON, `"two_factor":false`) {
+		t.Errorf("audit entry before %s, after %s", before, afterJSON)
+	}
+}
+
+func TestTOTPChangesAreAudited(t *testing.T) {
+	site := newTestSite(t)
+	createTestUser(t, "admin@example.com", true, false)
+	user := createTestUser(t, "customer@example.com", false, false)
+	secret := enableTestTOTP(t, user)
+
+	w := request(site, "POST", "/profile/2fa", url.Values{"action": {"disable"}, "code": {lastStepCode(t, user, secret, 1)}}, sessionCookie(t, user))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "has been disabled") {
+		t.Fatalf("disable: status %d", w.Code)
+	}
+	w = request(site, "POST", "/profile/2fa", url.Values{"action": {"setup"}}, sessionCookie(t, user))
+	if w.Code != http.StatusOK {
+		t.Fatalf("setup: status %d", w.Code)
+	}
+
+	for _, action := range []string{"user.2fa_disable", "user.2fa_setup"} {
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = ? AND user_id = ?", action, user.ID).Scan(&count)
+		if count != 1 {
+			t.Errorf("%d %s audit entries, want 1", count, action)
+		}
+	}
+}